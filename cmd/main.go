@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
 	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/services"
@@ -18,8 +25,36 @@ const (
 	appVersion   = "1.0.0"
 	configFile   = "config/config.json"
 	printersFile = "config/printers.json"
+	queueDir     = "queue"
+
+	// How often config and printers files are checked for changes while running
+	reloadPollInterval = 2 * time.Second
 )
 
+const usage = `Usage: %[1]s [command] [flags]
+
+Commands:
+  run        Connect the printers to the server and print orders (default)
+  setup      Create or update %[2]s
+  discover   Scan the local network for printers and register them; without a
+             terminal --yes is required and adds every printer found
+  printers   List, add, edit, remove, enable or disable printers
+  queue      Show the print queue of every printer
+
+Config flags (run, setup, discover), also read from the environment:
+  --api-url      API URL          (PM_API_URL)
+  --ws-url       WebSocket URL    (PM_WS_URL)
+  --api-key      Server API key   (PM_API_KEY)
+  --tenant       Tenant ID        (PM_TENANT_ID)
+  --restaurant   Restaurant ID    (PM_RESTAURANT_ID)
+
+Prompts are only shown when a terminal is attached; under cron or
+provisioning tools missing values are an error.
+
+While running, changes to %[2]s and %[3]s are applied without a
+restart (also on SIGHUP).
+`
+
 // --- Main ---
 
 func main() {
@@ -29,52 +64,138 @@ func main() {
 	ctx = context.WithValue(ctx, model.ContextAppAuthor, "Riboost Studio")
 	ctx = context.WithValue(ctx, model.ContextConfigFile, configFile)
 	ctx = context.WithValue(ctx, model.ContextPrintersFile, printersFile)
+	ctx = context.WithValue(ctx, model.ContextQueueDir, queueDir)
 	ctx = context.WithValue(ctx, model.TemplatePath, "templates")
 	ctx = context.WithValue(ctx, model.TemplateFile, "order.html")
 
-	// 0. Validate System Requirements
-	fmt.Println("=== System Validation ===")
-	if err := utils.ValidateSystemRequirements(); err != nil {
-		log.Fatal("System validation failed:", err)
+	// Without a command (e.g. started by cron) the agents run
+	command, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
-	fmt.Println("=== System OK ===")
-	fmt.Println()
 
-	// 1. Load Configuration
-	config, err := utils.LoadOrSetupConfig(ctx)
+	switch command {
+	case "run":
+		runCommand(ctx, args)
+	case "setup":
+		setupCommand(ctx, args)
+	case "discover":
+		discoverCommand(ctx, args)
+	case "printers":
+		printersCommand(ctx, args)
+	case "queue":
+		printQueues(ctx)
+	case "help":
+		printUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", command)
+		printUsage()
+		os.Exit(2)
+	}
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, usage, filepath.Base(os.Args[0]), configFile, printersFile)
+}
+
+// configFlags registers the flags overriding config values. Defaults come
+// from the environment so provisioning tools can use either.
+func configFlags(fs *flag.FlagSet) *utils.ConfigOptions {
+	opts := &utils.ConfigOptions{}
+	fs.StringVar(&opts.APIURL, "api-url", os.Getenv("PM_API_URL"), "API URL (env PM_API_URL)")
+	fs.StringVar(&opts.WSURL, "ws-url", os.Getenv("PM_WS_URL"), "WebSocket URL (env PM_WS_URL)")
+	fs.StringVar(&opts.APIKey, "api-key", os.Getenv("PM_API_KEY"), "server API key (env PM_API_KEY)")
+	fs.IntVar(&opts.TenantID, "tenant", envInt("PM_TENANT_ID"), "tenant ID (env PM_TENANT_ID)")
+	fs.IntVar(&opts.RestaurantID, "restaurant", envInt("PM_RESTAURANT_ID"), "restaurant ID (env PM_RESTAURANT_ID)")
+	fs.Usage = printUsage
+	return opts
+}
+
+func envInt(name string) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %q is not a number", name, value)
+	}
+	return n
+}
+
+// loadConfig loads the config (running first-time setup if needed) and
+// stores the server URLs in the context.
+func loadConfig(ctx context.Context, opts utils.ConfigOptions) (context.Context, model.Config) {
+	config, err := utils.LoadOrSetupConfig(ctx, opts)
 	if err != nil {
 		log.Fatal("Config error:", err)
 	}
-	fmt.Printf("Configuration loaded: AppVersion=%s, API URL=%s, WS URL=%s\n", config.AppVersion, config.ApiUrl, config.WsUrl)
 	ctx = context.WithValue(ctx, model.ContextAPIURL, config.ApiUrl)
 	ctx = context.WithValue(ctx, model.ContextWSURL, config.WsUrl)
+	return ctx, config
+}
 
-	// Sync Printers with Server
-	serverPrinters, err := services.GetPrintersFromServer(ctx, config.APIKey)
+// --- setup ---
+
+func setupCommand(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("setup", flag.ExitOnError)
+	opts := configFlags(fs)
+	fs.Parse(args)
+
+	config, err := utils.SetupConfig(ctx, *opts)
 	if err != nil {
-		log.Println("Error getting printers from server:", err)
+		log.Fatal("Setup error:", err)
 	}
-	utils.SavePrinters(printersFile, serverPrinters)
-	log.Printf("Synchronized %d printers from server.\n", len(serverPrinters))
+	fmt.Printf("Configuration: API URL=%s, WS URL=%s, Tenant=%d, Restaurant=%d\n",
+		config.ApiUrl, config.WsUrl, config.TenantID, config.RestaurantID)
+}
 
-	// 2. Load Printers
+// --- discover ---
+
+func discoverCommand(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+	opts := configFlags(fs)
+	yes := fs.Bool("yes", false, "add every printer found without asking")
+	fs.Parse(args)
+
+	// Unattended, every device listening on port 9100 would be added and registered
+	interactive := utils.IsInteractive()
+	if !interactive && !*yes {
+		log.Fatal("No terminal to confirm the printers found: run discover --yes to add all of them")
+	}
+
+	ctx, config := loadConfig(ctx, *opts)
+
+	fmt.Println("Starting discovery...")
+	found := services.DiscoverPrinters(config, interactive && !*yes)
+	if err := utils.AddNewPrinters(printersFile, found); err != nil {
+		log.Fatal("Error saving printers:", err)
+	}
+
+	// Printers already configured keep their settings; reload to register the new ones
 	printers, err := utils.LoadPrinters(ctx)
 	if err != nil {
-		log.Println("Error loading printers, starting fresh.")
+		log.Fatal("Error loading printers:", err)
 	}
+	registerPrinters(ctx, config, printers)
+	fmt.Printf("%d printer(s) configured.\n", len(printers))
+}
 
-	// 3. Discovery (if no printers found or forced)
-	if len(printers) == 0 {
-		fmt.Println("No printers configured. Starting discovery...")
-		newPrinters := services.DiscoverPrinters(config)
-		printers = append(printers, newPrinters...)
-		utils.SavePrinters(printersFile, printers)
-	}
+// printersMu serializes the changes to the printers file of a running agent:
+// the periodic sync and the reload both register printers and save them.
+var printersMu sync.Mutex
 
-	// 4. Register Printers (Get Agent Keys)
+// registerPrinters obtains an agent key for every printer that has none.
+func registerPrinters(ctx context.Context, config model.Config, printers []model.Printer) {
 	dirty := false
 	for i := range printers {
 		if printers[i].AgentKey == "" {
+			if printers[i].TenantID == 0 {
+				printers[i].TenantID = config.TenantID
+			}
+			if printers[i].RestaurantID == 0 {
+				printers[i].RestaurantID = config.RestaurantID
+			}
 			fmt.Printf("Registering printer '%s' with server...\n", printers[i].Name)
 			err := services.RegisterPrinterOnServer(ctx, &printers[i], config.APIKey)
 			if err != nil {
@@ -88,33 +209,308 @@ func main() {
 	if dirty {
 		utils.SavePrinters(printersFile, printers)
 	}
+}
 
-	// 5. Start Agent for each Printer
-	var wg sync.WaitGroup
-	activePrinters := 0
+// --- run ---
 
-	for _, p := range printers {
-		if p.AgentKey != "" {
-			activePrinters++
-			wg.Add(1)
-			// Run each printer agent in its own routine
-			go func(printer model.Printer) {
-				defer wg.Done()
-				services.RunAgent(ctx, printer, config)
-			}(p)
+func runCommand(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	opts := configFlags(fs)
+	fs.Parse(args)
+
+	// Cron starts the agent every few minutes: only one may run the queues
+	unlock, err := services.LockQueueDir(queueDir)
+	if err != nil {
+		log.Fatal("Cannot start: ", err)
+	}
+	defer unlock()
+
+	// 1. Load Configuration
+	ctx, config := loadConfig(ctx, *opts)
+	fmt.Printf("Configuration loaded: AppVersion=%s, API URL=%s, WS URL=%s\n", config.AppVersion, config.ApiUrl, config.WsUrl)
+
+	// Chrome may also start later, when a reload adds the first image printer
+	services.SetRenderConcurrency(config.RenderConcurrency)
+	defer services.CloseBrowserPool()
+
+	// Sync Printers with Server
+	syncPrinters(ctx, config, false)
+
+	// 2. Load Printers
+	printers, err := utils.LoadPrinters(ctx)
+	if err != nil {
+		log.Println("Error loading printers, starting fresh.")
+	}
+
+	// 3. Discovery (if no printers found); unattended runs never scan on their own
+	if len(printers) == 0 {
+		if utils.IsInteractive() {
+			fmt.Println("No printers configured. Starting discovery...")
+			newPrinters := services.DiscoverPrinters(config, true)
+			printers = append(printers, newPrinters...)
+			if err := utils.AddNewPrinters(printersFile, newPrinters); err != nil {
+				log.Println("Error saving printers:", err)
+			}
+		} else {
+			fmt.Println("No printers configured. Run the 'discover' command to add them.")
 		}
 	}
 
-	if activePrinters == 0 {
-		fmt.Println("No printers are registered with an Agent Key. Exiting.")
+	// 4. Register Printers (Get Agent Keys)
+	registerPrinters(ctx, config, printers)
+
+	// Load ticket templates and make sure every printer references a valid one
+	templates, err := services.LoadTemplates(ctx)
+	if err != nil {
+		log.Fatal("Template error:", err)
+	}
+	if err := services.ValidatePrinterTemplates(templates, printers); err != nil {
+		log.Fatal("Template error:", err)
+	}
+	fmt.Printf("Loaded templates: %s\n", strings.Join(templates.Names(), ", "))
+
+	// 5. Validate System Requirements (Chrome is only needed for image rendering)
+	requireChrome := services.RequiresChrome(printers)
+	fmt.Println("=== System Validation ===")
+	if err := utils.ValidateSystemRequirements(requireChrome); err != nil {
+		log.Fatal("System validation failed:", err)
+	}
+	fmt.Println("=== System OK ===")
+	fmt.Println()
+
+	// Shared headless Chrome used to render every ticket
+	if requireChrome {
+		services.StartBrowserPool()
+	}
+
+	// 6. Start Agent for each Printer
+	active := activePrinters(printers)
+	if len(active) == 0 {
+		fmt.Println("No enabled printers are registered with an Agent Key. Exiting.")
 		return
 	}
 
-	fmt.Printf("--- System Running. Controlling %d printers ---\n", activePrinters)
+	// Each printer gets its own agent; connections follow config.ConnectionMode
+	runCtx, stopAgents := context.WithCancel(ctx)
+	agentsDone := make(chan struct{})
+	updates := make(chan services.AgentSet, 1)
+	go func() {
+		services.RunAgents(runCtx, active, config, updates)
+		close(agentsDone)
+	}()
+
+	fmt.Printf("--- System Running. Controlling %d printers ---\n", len(active))
 
-	// Wait for interrupt to exit cleanly
+	stopSync := startPeriodicSync(runCtx, config)
+
+	// Apply config and printer changes until interrupted, then exit cleanly
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	changes := utils.WatchFiles(runCtx, reloadPollInterval, configFile, printersFile)
+	for running := true; running; {
+		select {
+		case sig := <-c:
+			if sig != syscall.SIGHUP {
+				running = false
+				continue
+			}
+			log.Println("SIGHUP received, reloading configuration...")
+		case <-changes:
+			log.Println("Configuration files changed, reloading...")
+		}
+		if set, ok := reloadAgentSet(ctx, *opts); ok {
+			// The periodic sync follows the new server settings
+			if !reflect.DeepEqual(config, set.Config) {
+				stopSync()
+				stopSync = startPeriodicSync(runCtx, set.Config)
+			}
+			config = set.Config
+			services.SetRenderConcurrency(config.RenderConcurrency)
+			sendLatest(updates, set)
+		}
+	}
 	fmt.Println("\nShutting down...")
+
+	stopSync()
+
+	// Agents finish in-progress jobs, unregister and save their queues
+	stopAgents()
+	shutdownTimeout := time.Duration(config.ShutdownTimeoutSeconds) * time.Second
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 30 * time.Second
+	}
+	select {
+	case <-agentsDone:
+		fmt.Println("All agents stopped.")
+	case <-c:
+		fmt.Println("Forced shutdown.")
+	case <-time.After(shutdownTimeout + 5*time.Second):
+		fmt.Println("Timed out waiting for agents, exiting.")
+	}
+}
+
+// activePrinters returns the printers that get an agent: registered and enabled.
+func activePrinters(printers []model.Printer) []model.Printer {
+	var active []model.Printer
+	for _, p := range printers {
+		switch {
+		case p.AgentKey == "":
+		case !p.IsEnabled:
+			fmt.Printf("Printer '%s' is disabled, leaving it offline.\n", p.Name)
+		default:
+			active = append(active, p)
+		}
+	}
+	return active
+}
+
+// sendLatest hands set to the agents without waiting for them: applying a set
+// waits for in-progress jobs, and signals must still be handled meanwhile. A
+// set not taken yet is replaced, only the latest one matters.
+func sendLatest(updates chan services.AgentSet, set services.AgentSet) {
+	select {
+	case updates <- set:
+	default:
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- set
+	}
+}
+
+// disabledPrinters returns the agent keys of the registered printers that are
+// turned off, whose queues are kept for when they are enabled again.
+func disabledPrinters(printers []model.Printer) []string {
+	var keys []string
+	for _, p := range printers {
+		if p.AgentKey != "" && !p.IsEnabled {
+			keys = append(keys, p.AgentKey)
+		}
+	}
+	return keys
+}
+
+// reloadAgentSet reads the config and printers files again. When anything is
+// invalid the error is logged and the running agents are left as they are.
+func reloadAgentSet(ctx context.Context, opts utils.ConfigOptions) (services.AgentSet, bool) {
+	config, err := utils.LoadConfig(ctx, opts)
+	if err != nil {
+		log.Println("Reload failed, keeping the current configuration:", err)
+		return services.AgentSet{}, false
+	}
+	ctx = context.WithValue(ctx, model.ContextAPIURL, config.ApiUrl)
+	ctx = context.WithValue(ctx, model.ContextWSURL, config.WsUrl)
+
+	// A periodic sync may be rewriting the printers file meanwhile
+	printersMu.Lock()
+	printers, err := utils.LoadPrinters(ctx)
+	if err == nil {
+		registerPrinters(ctx, config, printers)
+	}
+	printersMu.Unlock()
+	if err != nil {
+		log.Println("Reload failed, keeping the current printers:", err)
+		return services.AgentSet{}, false
+	}
+
+	templates, err := services.LoadTemplates(ctx)
+	if err == nil {
+		err = services.ValidatePrinterTemplates(templates, printers)
+	}
+	if err != nil {
+		log.Println("Reload failed, keeping the current printers. Template error:", err)
+		return services.AgentSet{}, false
+	}
+
+	active := activePrinters(printers)
+	if services.RequiresChrome(active) {
+		if found, _ := utils.CheckChrome(); !found {
+			log.Println("Reload failed, keeping the current printers: Chrome is required to render tickets but was not found")
+			return services.AgentSet{}, false
+		}
+	}
+	return services.AgentSet{Printers: active, Config: config, Disabled: disabledPrinters(printers)}, true
+}
+
+// syncPrinters reconciles config/printers.json with the back office. When the
+// server cannot be reached the local printers are used as they are.
+func syncPrinters(ctx context.Context, config model.Config, allowDeleteAll bool) services.SyncReport {
+	printersMu.Lock()
+	_, report, err := services.SyncPrinters(ctx, config, allowDeleteAll)
+	printersMu.Unlock()
+	if err != nil {
+		log.Println("Error synchronizing printers with server:", err)
+		return report
+	}
+	log.Printf("Synchronized printers with server: %s", report)
+	for _, conflict := range report.Conflicts {
+		log.Printf("Sync conflict: %s", conflict)
+	}
+	return report
+}
+
+// startPeriodicSync runs the printer sync every PrinterSyncIntervalMinutes
+// with the given config, until the returned function is called.
+func startPeriodicSync(ctx context.Context, config model.Config) (stop func()) {
+	ctx, stop = context.WithCancel(ctx)
+	if config.PrinterSyncIntervalMinutes > 0 {
+		ctx = context.WithValue(ctx, model.ContextAPIURL, config.ApiUrl)
+		go syncPeriodically(ctx, config, time.Duration(config.PrinterSyncIntervalMinutes)*time.Minute)
+	}
+	return stop
+}
+
+func syncPeriodically(ctx context.Context, config model.Config, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Changes land in the printers file and are picked up by the reload
+			syncPrinters(ctx, config, false)
+		}
+	}
+}
+
+// printQueues lists the jobs of every printer in the order they will print.
+func printQueues(ctx context.Context) {
+	printers, err := utils.LoadPrinters(ctx)
+	if err != nil {
+		log.Fatal("Error loading printers:", err)
+	}
+
+	for _, p := range printers {
+		if p.AgentKey == "" {
+			continue
+		}
+		queue, err := services.OpenJobQueue(queueDir, p.AgentKey)
+		if err != nil {
+			log.Printf("[%s] %v", p.Name, err)
+			continue
+		}
+		jobs := queue.Snapshot()
+		fmt.Printf("=== %s (%d jobs) ===\n", p.Name, len(jobs))
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ORDER\tPRIORITY\tSTATUS\tCOPIES\tATTEMPTS\tQUEUED\tNEXT ATTEMPT\tLAST ERROR")
+		for _, job := range jobs {
+			priority := job.Data.Priority
+			if priority == "" {
+				priority = model.PriorityNormal
+			}
+			next := "-"
+			if job.Status == model.JobStatusPending {
+				next = job.NextAttemptAt.Format("15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d/%d\t%d\t%s\t%s\t%s\n",
+				job.OrderID, priority, job.Status, job.CopiesPrinted, job.Copies(), job.Attempts,
+				job.CreatedAt.Format("15:04:05"), next, job.LastError)
+		}
+		w.Flush()
+		fmt.Println()
+	}
 }
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/services"
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/utils"
+)
+
+const printersUsage = `Usage: %[1]s printers <list|add|edit|remove|enable|disable|pause|resume|sync> [flags]
+
+  list                       Show the configured printers and, while the agent runs,
+                             their connection state
+  add --name N --ip IP       Add a printer (see flags below)
+  edit <printer> [flags]     Change the given settings of a printer
+  remove <printer>           Delete a printer and its queue, once no job is pending
+  enable|disable <printer>   Turn printing on or off for a printer
+  pause|resume <printer>     Hold jobs in the queue of a running printer, or print them
+  sync [--delete-all]        Take the printers' changes from the back office and register
+                             new local printers; --delete-all confirms deleting every
+                             printer the server no longer lists. Local edits and removals
+                             are not sent to the server, only reported as conflicts
+
+<printer> is a name, IP address or agent key.
+
+Printer flags (add, edit):
+  --name, --ip, --port, --type, --size, --description, --renderer,
+  --dithering, --code-page, --template, --fallback
+  --register   register the printer with the server (again, if it has a key)
+`
+
+// --- printers ---
+
+func printersCommand(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		printPrintersUsage()
+		os.Exit(2)
+	}
+
+	printers, err := utils.LoadPrinters(ctx)
+	if err != nil {
+		log.Fatal("Error loading printers:", err)
+	}
+
+	switch action, args := args[0], args[1:]; action {
+	case "list":
+		listPrinters(printers)
+	case "add":
+		addPrinter(ctx, printers, args)
+	case "edit":
+		editPrinter(ctx, printers, args)
+	case "remove":
+		removePrinter(printers, args)
+	case "enable", "disable":
+		i := findPrinter(printers, args)
+		printers[i].IsEnabled = action == "enable"
+		if err := utils.SavePrinters(printersFile, printers[i:i+1]); err != nil {
+			log.Fatal("Error saving printers:", err)
+		}
+		fmt.Printf("Printer '%s' %sd.\n", printers[i].Name, action)
+		fmt.Println("A running agent applies this within a few seconds.")
+	case "pause", "resume":
+		i := findPrinter(printers, args)
+		p := printers[i]
+		if p.AgentKey == "" {
+			log.Fatalf("Printer '%s' is not registered", p.Name)
+		}
+		if err := services.SetPaused(queueDir, p.AgentKey, action == "pause"); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Printer '%s' %sd. A running agent applies this within a few seconds.\n", p.Name, action)
+	case "sync":
+		fs := flag.NewFlagSet("sync", flag.ExitOnError)
+		deleteAll := fs.Bool("delete-all", false, "delete local printers even when the server lists none of them")
+		fs.Usage = printPrintersUsage
+		fs.Parse(args)
+
+		ctx, config := loadConfig(ctx, utils.ConfigOptions{})
+		report := syncPrinters(ctx, config, *deleteAll)
+		for _, list := range []struct {
+			label string
+			names []string
+		}{
+			{"Created", report.Created},
+			{"Updated", report.Updated},
+			{"Deleted", report.Deleted},
+			{"Registered", report.Pushed},
+		} {
+			if len(list.names) > 0 {
+				fmt.Printf("%s: %s\n", list.label, strings.Join(list.names, ", "))
+			}
+		}
+		if len(report.Conflicts) > 0 {
+			fmt.Println("Local edits and removals are not sent to the server, make them in the back office too.")
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown printers command %q\n\n", action)
+		printPrintersUsage()
+		os.Exit(2)
+	}
+}
+
+// removePrinter deletes a printer together with its queue. A printer with
+// jobs still waiting is kept, so no order is dropped without notice.
+func removePrinter(printers []model.Printer, args []string) {
+	i := findPrinter(printers, args)
+	removed := printers[i]
+	if removed.AgentKey != "" {
+		queue, err := services.OpenJobQueue(queueDir, removed.AgentKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if pending := queue.Pending(); pending > 0 {
+			log.Fatalf("Printer '%s' still has %d pending job(s). Let them print, or disable the printer to keep them, before removing it.", removed.Name, pending)
+		}
+	}
+
+	printers = append(printers[:i], printers[i+1:]...)
+	if err := utils.WritePrinters(printersFile, printers); err != nil {
+		log.Fatal("Error saving printers:", err)
+	}
+	fmt.Printf("Printer '%s' removed.\n", removed.Name)
+	if removed.AgentKey != "" {
+		fmt.Println("It is still registered: delete it in the back office too.")
+	}
+
+	// A running agent stops the printer and deletes its files itself
+	if removed.AgentKey == "" || services.AgentRunning(queueDir) {
+		return
+	}
+	if err := services.RemovePrinterFiles(queueDir, removed.AgentKey); err != nil {
+		log.Println("Warning:", err)
+	}
+}
+
+func printPrintersUsage() {
+	fmt.Fprintf(os.Stderr, printersUsage, filepath.Base(os.Args[0]))
+}
+
+// findPrinter resolves the <printer> argument or exits.
+func findPrinter(printers []model.Printer, args []string) int {
+	if len(args) != 1 {
+		printPrintersUsage()
+		os.Exit(2)
+	}
+	i, err := utils.FindPrinter(printers, args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	return i
+}
+
+func listPrinters(printers []model.Printer) {
+	if len(printers) == 0 {
+		fmt.Println("No printers configured.")
+		return
+	}
+
+	running := services.AgentRunning(queueDir)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tIP\tPORT\tTYPE\tSIZE\tRENDERER\tENABLED\tPAUSED\tCONNECTION\tAGENT KEY")
+	for _, p := range printers {
+		agentKey := p.AgentKey
+		if agentKey == "" {
+			agentKey = "(not registered)"
+		}
+		renderer := p.Renderer
+		if renderer == "" {
+			renderer = model.RendererImage
+		}
+		paused := p.AgentKey != "" && services.IsPaused(queueDir, p.AgentKey)
+		connection := "-"
+		if running && p.AgentKey != "" && p.IsEnabled {
+			connection = string(services.ReadConnectionState(queueDir, p.AgentKey))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s\t%t\t%t\t%s\t%s\n",
+			p.Name, p.IP, p.Port, p.Type, p.Size, renderer, p.IsEnabled, paused, connection, agentKey)
+	}
+	w.Flush()
+}
+
+// printerFlags are the settings accepted by add and edit.
+type printerFlags struct {
+	fs       *flag.FlagSet
+	printer  model.Printer
+	register bool
+}
+
+func newPrinterFlags(name string, defaults model.Printer) *printerFlags {
+	f := &printerFlags{fs: flag.NewFlagSet(name, flag.ExitOnError), printer: defaults}
+	p := &f.printer
+	f.fs.StringVar(&p.Name, "name", p.Name, "printer name (e.g. Kitchen)")
+	f.fs.StringVar(&p.IP, "ip", p.IP, "IP address")
+	f.fs.IntVar(&p.Port, "port", p.Port, "raw printing port")
+	f.fs.StringVar(&p.Type, "type", p.Type, "thermal, inkjet or laser")
+	f.fs.IntVar(&p.Size, "size", p.Size, "dots per line for thermal printers (384 or 576)")
+	f.fs.StringVar(&p.Description, "description", p.Description, "description")
+	f.fs.StringVar(&p.Renderer, "renderer", p.Renderer, "image or text")
+	f.fs.StringVar(&p.Dithering, "dithering", p.Dithering, "threshold, floyd-steinberg, atkinson or bayer")
+	f.fs.StringVar(&p.CodePage, "code-page", p.CodePage, "pc437, pc850 or pc858")
+	f.fs.StringVar(&p.Template, "template", p.Template, "ticket template in templates/")
+	f.fs.StringVar(&p.Fallback, "fallback", p.Fallback, "backup printer (name or agent key)")
+	f.fs.BoolVar(&f.register, "register", false, "register the printer with the server")
+	f.fs.Usage = printPrintersUsage
+	return f
+}
+
+func addPrinter(ctx context.Context, printers []model.Printer, args []string) {
+	f := newPrinterFlags("add", model.Printer{
+		Port:      9100,
+		Type:      model.PrinterTypeThermal,
+		Size:      utils.DefaultPrinterSize,
+		IsEnabled: true,
+	})
+	f.fs.Parse(args)
+	p := f.printer
+
+	if err := utils.ValidatePrinter(p); err != nil {
+		log.Fatal("Invalid printer: ", err)
+	}
+	checkUniqueName(printers, p, -1)
+	checkUniqueDevice(printers, p, -1)
+
+	if f.register {
+		registerPrinter(ctx, &p)
+	}
+	if err := utils.SavePrinters(printersFile, []model.Printer{p}); err != nil {
+		log.Fatal("Error saving printers:", err)
+	}
+	fmt.Printf("Printer '%s' added.\n", p.Name)
+}
+
+func editPrinter(ctx context.Context, printers []model.Printer, args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		printPrintersUsage()
+		os.Exit(2)
+	}
+	i := findPrinter(printers, args[:1])
+	previous := printers[i]
+
+	f := newPrinterFlags("edit", previous)
+	f.fs.Parse(args[1:])
+	p := f.printer
+
+	if err := utils.ValidatePrinter(p); err != nil {
+		log.Fatal("Invalid printer: ", err)
+	}
+	checkUniqueName(printers, p, i)
+	checkUniqueDevice(printers, p, i)
+
+	if f.register {
+		registerPrinter(ctx, &p)
+	}
+
+	// Rewrite the whole list: an edited IP or agent key would not match the old entry
+	printers[i] = p
+	if err := utils.WritePrinters(printersFile, printers); err != nil {
+		log.Fatal("Error saving printers:", err)
+	}
+	fmt.Printf("Printer '%s' updated.\n", p.Name)
+}
+
+// checkUniqueName refuses duplicate names, since fallbacks and routes refer
+// to printers by name.
+func checkUniqueName(printers []model.Printer, p model.Printer, self int) {
+	for i, existing := range printers {
+		if i != self && strings.EqualFold(existing.Name, p.Name) {
+			log.Fatalf("A printer named '%s' already exists", existing.Name)
+		}
+	}
+}
+
+// checkUniqueDevice refuses a second entry for the same printer: the next
+// upsert by SavePrinters would merge the two.
+func checkUniqueDevice(printers []model.Printer, p model.Printer, self int) {
+	for i, existing := range printers {
+		if i != self && utils.SamePrinter(existing, p) {
+			log.Fatalf("A printer with IP %s already exists ('%s'), use edit instead", p.IP, existing.Name)
+		}
+	}
+}
+
+func registerPrinter(ctx context.Context, p *model.Printer) {
+	ctx, config := loadConfig(ctx, utils.ConfigOptions{})
+	p.TenantID = config.TenantID
+	p.RestaurantID = config.RestaurantID
+
+	fmt.Printf("Registering printer '%s' with server...\n", p.Name)
+	if err := services.RegisterPrinterOnServer(ctx, p, config.APIKey); err != nil {
+		log.Fatalf("Failed to register %s: %v", p.Name, err)
+	}
+	fmt.Printf("Success! Agent Key: %s\n", p.AgentKey)
+}
@@ -6,6 +6,8 @@ require (
 	github.com/chromedp/cdproto v0.0.0-20250803210736-d308e07a266d
 	github.com/chromedp/chromedp v0.14.2
 	github.com/gorilla/websocket v1.5.1
+	golang.org/x/net v0.17.0
+	golang.org/x/sys v0.38.0
 )
 
 require (
@@ -14,6 +16,4 @@ require (
 	github.com/gobwas/httphead v0.1.0 // indirect
 	github.com/gobwas/pool v0.2.1 // indirect
 	github.com/gobwas/ws v1.4.0 // indirect
-	golang.org/x/net v0.17.0 // indirect
-	golang.org/x/sys v0.38.0 // indirect
 )
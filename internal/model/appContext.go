@@ -10,6 +10,7 @@ const (
 	ContextPrintersFile contextKey = "printersFile"
 	ContextAPIURL       contextKey = "apiURL"
 	ContextWSURL        contextKey = "wsURL"
+	ContextQueueDir     contextKey = "queueDir"
 	TemplatePath        contextKey = "templatePath"
 	TemplateFile        contextKey = "templateFile"
 )
@@ -1,5 +1,7 @@
 package model
 
+import "encoding/json"
+
 // --- Configuration Structures ---
 
 // Printer type constants
@@ -9,6 +11,34 @@ const (
 	PrinterTypeLaser   = "laser"
 )
 
+// Ticket renderers: "image" rasterizes the HTML with Chrome,
+// "text" sends native ESC/POS text commands (thermal printers only)
+const (
+	RendererImage = "image"
+	RendererText  = "text"
+)
+
+// ESC/POS code pages supported by the text renderer
+const (
+	CodePagePC437 = "pc437"
+	CodePagePC850 = "pc850"
+	CodePagePC858 = "pc858"
+)
+
+// WebSocket connection modes
+const (
+	ConnectionModePerPrinter  = "per-printer" // one socket per printer (default)
+	ConnectionModeMultiplexed = "multiplexed" // one socket for every printer
+)
+
+// Dithering algorithms used when converting tickets to thermal raster
+const (
+	DitherThreshold      = "threshold"
+	DitherFloydSteinberg = "floyd-steinberg"
+	DitherAtkinson       = "atkinson"
+	DitherBayer          = "bayer"
+)
+
 type Config struct {
 	AppVersion   string `json:"appVersion"`
 	APIKey       string `json:"apiKey"`
@@ -16,17 +46,61 @@ type Config struct {
 	RestaurantID int    `json:"restaurantId"`
 	ApiUrl       string `json:"apiUrl"`
 	WsUrl        string `json:"wsUrl"`
+
+	// Max number of tickets rendered by headless Chrome at the same time
+	RenderConcurrency int `json:"renderConcurrency,omitempty"`
+	// Attempts before a queued print job is reported as print_failed
+	JobMaxAttempts int `json:"jobMaxAttempts,omitempty"`
+	// How long printed orders are remembered to detect redeliveries
+	DedupeRetentionHours int `json:"dedupeRetentionHours,omitempty"`
+	// What to do with a redelivered order: "skip" (default) or "flag"
+	DuplicatePolicy string `json:"duplicatePolicy,omitempty"`
+	// "per-printer" (default) or "multiplexed"
+	ConnectionMode string `json:"connectionMode,omitempty"`
+	// How long an in-progress print may run after a shutdown request
+	ShutdownTimeoutSeconds int `json:"shutdownTimeoutSeconds,omitempty"`
+	// Client WebSocket pings; the connection is dropped when no pong arrives in time
+	HeartbeatIntervalSeconds int `json:"heartbeatIntervalSeconds,omitempty"`
+	HeartbeatTimeoutSeconds  int `json:"heartbeatTimeoutSeconds,omitempty"`
+	// How often printer health is checked and reported to the server
+	StatusIntervalSeconds int `json:"statusIntervalSeconds,omitempty"`
+	// Category -> printer (name or agent key). Item categories are looked up
+	// first, then "plates" / "drinks"; unmatched lines stay on the receiving printer.
+	Routes map[string]string `json:"routes,omitempty"`
+	// Reconcile printers with the back office every N minutes while running (0 = only at startup)
+	PrinterSyncIntervalMinutes int `json:"printerSyncIntervalMinutes,omitempty"`
 }
 
 type Printer struct {
-	Name         string `json:"name"`
-	IP           string `json:"ip"`
-	Port         int    `json:"port"`
-	Description  string `json:"description"`
-	IsEnabled    bool   `json:"isEnabled"`
-	TenantID     int    `json:"tenantId"`
-	RestaurantID int    `json:"restaurantId,omitempty"`
-	AgentKey     string `json:"agent_key,omitempty"` // Assigned by server
-	Type         string `json:"type,omitempty"`
-	Size         int    `json:"size,omitempty"`
+	Name           string  `json:"name"`
+	IP             string  `json:"ip"`
+	Port           int     `json:"port"`
+	Description    string  `json:"description"`
+	IsEnabled      bool    `json:"isEnabled"`
+	TenantID       int     `json:"tenantId"`
+	RestaurantID   int     `json:"restaurantId,omitempty"`
+	AgentKey       string  `json:"agent_key,omitempty"` // Assigned by server
+	Type           string  `json:"type,omitempty"`
+	Size           int     `json:"size,omitempty"`
+	Dithering      string  `json:"dithering,omitempty"`      // threshold, floyd-steinberg, atkinson, bayer
+	Renderer       string  `json:"renderer,omitempty"`       // image (default) or text
+	CodePage       string  `json:"codePage,omitempty"`       // pc437, pc850, pc858 (default)
+	Template       string  `json:"template,omitempty"`       // Ticket layout in templates/ (e.g. "kitchen")
+	StatusBack     bool    `json:"statusBack,omitempty"`     // Printer supports automatic status back (GS a)
+	Fallback       string  `json:"fallback,omitempty"`       // Backup printer (name or agent key) for failed jobs
+	BandHeight     int     `json:"bandHeight,omitempty"`     // Max raster rows per GS v 0 command (default 256, at most 1024)
+	MarginTopMM    float64 `json:"marginTopMm,omitempty"`    // Blank paper kept above a trimmed ticket
+	MarginBottomMM float64 `json:"marginBottomMm,omitempty"` // Blank paper kept below a trimmed ticket
+}
+
+// UnmarshalJSON treats a missing isEnabled as enabled, so printers saved
+// before the field was honored, and server entries without it, keep printing.
+func (p *Printer) UnmarshalJSON(data []byte) error {
+	type plain Printer // same fields, without this method
+	decoded := plain{IsEnabled: true}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*p = Printer(decoded)
+	return nil
 }
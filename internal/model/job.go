@@ -0,0 +1,175 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// --- Print Jobs (persisted in the per-printer queue) ---
+
+type JobStatus string
+
+// Printer status reported with each job result
+const (
+	PrinterStatusOnline      = "online"
+	PrinterStatusUnreachable = "unreachable"
+	PrinterStatusError       = "error"
+	PrinterStatusOffline     = "offline"
+	PrinterStatusCoverOpen   = "cover_open"
+	PrinterStatusPaperEnd    = "paper_end"
+)
+
+// PrinterState is the condition reported by an ESC/POS printer through
+// real-time status (DLE EOT) or automatic status back (GS a).
+type PrinterState struct {
+	Offline              bool `json:"offline"`
+	CoverOpen            bool `json:"coverOpen"`
+	FeedButton           bool `json:"feedButton"`
+	PaperNearEnd         bool `json:"paperNearEnd"`
+	PaperEnd             bool `json:"paperEnd"`
+	CutterError          bool `json:"cutterError"`
+	MechanicalError      bool `json:"mechanicalError"`
+	UnrecoverableError   bool `json:"unrecoverableError"`
+	AutoRecoverableError bool `json:"autoRecoverableError"`
+}
+
+// HasError reports any of the printer error conditions.
+func (s PrinterState) HasError() bool {
+	return s.CutterError || s.MechanicalError || s.UnrecoverableError || s.AutoRecoverableError
+}
+
+// NeedsAttention reports conditions that only staff can fix, as opposed to
+// transient ones (e.g. head overheated) the printer recovers from alone.
+func (s PrinterState) NeedsAttention() bool {
+	return s.CoverOpen || s.PaperEnd || s.CutterError || s.MechanicalError || s.UnrecoverableError
+}
+
+// Ready reports whether the printer can print right now.
+func (s PrinterState) Ready() bool {
+	return !s.Offline && !s.CoverOpen && !s.PaperEnd && !s.HasError()
+}
+
+// Status maps the state to the printer status reported to the server.
+func (s PrinterState) Status() string {
+	switch {
+	case s.PaperEnd:
+		return PrinterStatusPaperEnd
+	case s.CoverOpen:
+		return PrinterStatusCoverOpen
+	case s.HasError():
+		return PrinterStatusError
+	case s.Offline:
+		return PrinterStatusOffline
+	}
+	return PrinterStatusOnline
+}
+
+func (s PrinterState) String() string {
+	var flags []string
+	add := func(set bool, name string) {
+		if set {
+			flags = append(flags, name)
+		}
+	}
+	add(s.Offline, "offline")
+	add(s.CoverOpen, "cover open")
+	add(s.FeedButton, "feeding paper")
+	add(s.PaperEnd, "paper end")
+	add(s.PaperNearEnd && !s.PaperEnd, "paper near end")
+	add(s.CutterError, "autocutter error")
+	add(s.MechanicalError, "mechanical error")
+	add(s.UnrecoverableError, "unrecoverable error")
+	add(s.AutoRecoverableError, "head overheated")
+	if len(flags) == 0 {
+		return "ready"
+	}
+	return strings.Join(flags, ", ")
+}
+
+const (
+	JobStatusPending  JobStatus = "pending"
+	JobStatusPrinted  JobStatus = "printed"
+	JobStatusFailed   JobStatus = "print_failed"
+	JobStatusRerouted JobStatus = "rerouted" // Handed over to the fallback printer
+	JobStatusRouted   JobStatus = "routed"   // Split across stations, only the routing report is left
+)
+
+type PrintJob struct {
+	ID              string        `json:"id"`
+	AgentKey        string        `json:"agentKey"`
+	OrderID         int           `json:"orderId"`
+	Data            PrinterData   `json:"data"`
+	Status          JobStatus     `json:"status"`
+	Attempts        int           `json:"attempts"`
+	CopiesPrinted   int           `json:"copiesPrinted"`
+	LastError       string        `json:"lastError,omitempty"`
+	CreatedAt       time.Time     `json:"createdAt"`
+	NextAttemptAt   time.Time     `json:"nextAttemptAt"`
+	FinishedAt      time.Time     `json:"finishedAt,omitempty"`
+	Duplicate       bool          `json:"duplicate,omitempty"` // Same order already printed recently
+	BytesSent       int           `json:"bytesSent"`
+	RenderTime      time.Duration `json:"renderTime"`
+	PrintTime       time.Duration `json:"printTime"`
+	PrinterStatus   string        `json:"printerStatus,omitempty"`
+	ReroutedFrom    string        `json:"reroutedFrom,omitempty"`    // Name of the printer that failed
+	ReroutedFromKey string        `json:"reroutedFromKey,omitempty"` // Agent key of the printer that failed
+	ReroutedTo      string        `json:"reroutedTo,omitempty"`      // Agent key of the fallback printer
+	Routes          []RouteReport `json:"routes,omitempty"`          // Parts of a routed order
+}
+
+// IsTerminal reports whether the job reached printed or print_failed.
+// Terminal jobs stay in the queue until the server has been notified.
+func (j *PrintJob) IsTerminal() bool {
+	switch j.Status {
+	case JobStatusPrinted, JobStatusFailed, JobStatusRerouted, JobStatusRouted:
+		return true
+	}
+	return false
+}
+
+// Copies returns the number of copies requested (at least 1).
+func (j *PrintJob) Copies() int {
+	if j.Data.Copies < 1 {
+		return 1
+	}
+	return j.Data.Copies
+}
+
+// Report builds the details sent to the server with the job result.
+func (j *PrintJob) Report() JobReport {
+	return JobReport{
+		JobID:         j.ID,
+		Copies:        j.Copies(),
+		CopiesPrinted: j.CopiesPrinted,
+		BytesSent:     j.BytesSent,
+		Attempts:      j.Attempts,
+		RenderMs:      j.RenderTime.Milliseconds(),
+		PrintMs:       j.PrintTime.Milliseconds(),
+		PrinterStatus: j.PrinterStatus,
+		Duplicate:     j.Duplicate,
+		ReroutedFrom:  j.ReroutedFromKey,
+	}
+}
+
+// PrintRecord remembers a printed order, used to detect redelivered messages.
+type PrintRecord struct {
+	OrderID      int       `json:"orderId"`
+	TemplateUsed int       `json:"templateUsed"`
+	Timestamp    string    `json:"timestamp"`
+	PrintedAt    time.Time `json:"printedAt"`
+}
+
+// Key identifies the same print request across redeliveries.
+func (r PrintRecord) Key() string {
+	return fmt.Sprintf("%d|%d|%s", r.OrderID, r.TemplateUsed, r.Timestamp)
+}
+
+// RecordFor builds the history record of a print job.
+func RecordFor(data PrinterData) PrintRecord {
+	return PrintRecord{
+		OrderID:      data.Metadata.OrderId,
+		TemplateUsed: data.Metadata.TemplateUsed,
+		Timestamp:    data.Metadata.Timestamp,
+	}
+}
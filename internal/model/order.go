@@ -1,5 +1,11 @@
 package model
 
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
 // --- Order Structures (Matching your JSON) ---
 type OrderMessage struct {
 	Type     string       `json:"type"`
@@ -14,12 +20,34 @@ type OrderPayload struct {
 
 type PrinterData struct {
 	Content  string   `json:"content,omitempty"`
+	Order    *Order   `json:"order,omitempty"` // Structured order, rendered locally when Content is empty
 	Copies   int      `json:"copies,omitempty"`
 	Metadata Metadata `json:"metadata,omitempty"`
 	Priority string   `json:"priority,omitempty"`
 	Type     string   `json:"type,omitempty"`
 }
 
+// Print priorities (PrinterData.Priority); empty or unknown values are normal
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+	PriorityRush   = "rush"
+)
+
+// PriorityLevel ranks the request priority: higher prints first.
+func (d PrinterData) PriorityLevel() int {
+	switch strings.ToLower(strings.TrimSpace(d.Priority)) {
+	case PriorityLow:
+		return 0
+	case PriorityHigh:
+		return 2
+	case PriorityRush, "urgent":
+		return 3
+	}
+	return 1
+}
+
 type Metadata struct {
 	OrderId      int    `json:"orderId"`
 	TenantId     int    `json:"tenantId"`
@@ -28,4 +56,86 @@ type Metadata struct {
 	TemplateName string `json:"templateName"`
 	TemplateUsed int    `json:"templateUsed"`
 	Timestamp    string `json:"timestamp"`
-}
\ No newline at end of file
+}
+
+// --- Structured Order (rendered with templates/order.html) ---
+
+type Order struct {
+	ID          int          `json:"id"`
+	NOrder      int          `json:"nOrder"`
+	Year        int          `json:"year"`
+	Status      string       `json:"status"`
+	CreatedAt   string       `json:"createdAt"`
+	Notes       string       `json:"notes,omitempty"`
+	TotalAmount Money        `json:"totalAmount"`
+	Restaurant  Restaurant   `json:"restaurant"`
+	Table       *Table       `json:"table,omitempty"` // nil for takeaway/delivery
+	Plates      []OrderPlate `json:"plates,omitempty"`
+	Drinks      []OrderDrink `json:"drinks,omitempty"`
+}
+
+type Restaurant struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type Table struct {
+	ID       int `json:"id"`
+	Number   int `json:"number"`
+	Capacity int `json:"capacity"`
+}
+
+type OrderPlate struct {
+	LineID             int                 `json:"lineId"`
+	Plate              Item                `json:"plate"`
+	Quantity           int                 `json:"quantity"`
+	UnitPrice          Money               `json:"unitPrice"`
+	Subtotal           Money               `json:"subtotal"`
+	Notes              string              `json:"notes,omitempty"`
+	OrderPlateProducts []OrderPlateProduct `json:"orderPlateProducts,omitempty"`
+}
+
+type OrderPlateProduct struct {
+	Product  Item  `json:"product"`
+	Quantity int   `json:"quantity"`
+	Subtotal Money `json:"subtotal"`
+}
+
+type OrderDrink struct {
+	LineID    int    `json:"lineId"`
+	Drink     Item   `json:"drink"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice Money  `json:"unitPrice"`
+	Subtotal  Money  `json:"subtotal"`
+	Notes     string `json:"notes,omitempty"`
+}
+
+// Item is a plate, drink or product as referenced by an order line
+type Item struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Category string `json:"category,omitempty"`
+}
+
+// Money accepts both JSON numbers and numeric strings (e.g. "12.50"),
+// since decimal columns are often serialized as strings by the server.
+type Money float64
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	raw := strings.Trim(string(data), `"`)
+	if raw == "" || raw == "null" {
+		*m = 0
+		return nil
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return err
+	}
+	*m = Money(v)
+	return nil
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(float64(m))
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Money
+		wantErr bool
+	}{
+		{"number", `12.5`, 12.5, false},
+		{"integer", `8`, 8, false},
+		{"negative", `-3.2`, -3.2, false},
+		{"string", `"12.50"`, 12.5, false},
+		{"empty string", `""`, 0, false},
+		{"null", `null`, 0, false},
+		{"comma decimal", `"12,50"`, 0, true},
+		{"text", `"free"`, 0, true},
+		{"bool", `true`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Money(99) // overwritten, even by null
+			err := json.Unmarshal([]byte(tt.data), &m)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal(%s) error = %v, want error %v", tt.data, err, tt.wantErr)
+			}
+			if !tt.wantErr && m != tt.want {
+				t.Fatalf("Unmarshal(%s) = %v, want %v", tt.data, float64(m), float64(tt.want))
+			}
+		})
+	}
+}
+
+func TestMoneyInOrderLine(t *testing.T) {
+	var line OrderPlate
+	if err := json.Unmarshal([]byte(`{"unitPrice":"4.50","subtotal":9}`), &line); err != nil {
+		t.Fatal(err)
+	}
+	if line.UnitPrice != 4.5 || line.Subtotal != 9 {
+		t.Fatalf("line = %+v, want unit price 4.5 and subtotal 9", line)
+	}
+	data, err := json.Marshal(line.UnitPrice)
+	if err != nil || string(data) != "4.5" {
+		t.Fatalf("Marshal = %s, %v, want the number 4.5", data, err)
+	}
+}
@@ -1,6 +1,9 @@
 package model
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 type MessageType string
 
@@ -13,15 +16,55 @@ const (
 	MessageTypeNewOrder    MessageType = "print_order"
 	MessageTypePrinted     MessageType = "printed"
 	MessageTypePrintFailed MessageType = "print_failed"
+	MessageTypeError       MessageType = "error"
+	MessageTypePrinterStatus MessageType = "printer_status"
+	MessageTypeRerouted      MessageType = "rerouted"
+	MessageTypeRouted        MessageType = "routed"
+	MessageTypePause         MessageType = "pause"  // Hold jobs in the queue
+	MessageTypeResume        MessageType = "resume" // Print held jobs
+)
+
+// ConnectionState is the lifecycle of an agent's WebSocket connection
+type ConnectionState string
+
+const (
+	ConnStateDisconnected ConnectionState = "disconnected"
+	ConnStateConnecting   ConnectionState = "connecting"
+	ConnStateRegistering  ConnectionState = "registering"
+	ConnStateRegistered   ConnectionState = "registered"
+	ConnStateBackingOff   ConnectionState = "backing-off"
 )
 
 // --- WebSocket Messages ---
 
 type WSMessage struct {
-	Type     MessageType     `json:"type"`
-	AgentKey string          `json:"agent_key,omitempty"`
-	Order    json.RawMessage `json:"order,omitempty"` // Keep raw to parse into specific structs
-	Error    string          `json:"error,omitempty"`
+	Type      MessageType     `json:"type"`
+	AgentKey  string          `json:"agent_key,omitempty"`
+	AgentKeys []string        `json:"agent_keys,omitempty"` // Multiplexed connection: every printer on this socket
+	Order     json.RawMessage `json:"order,omitempty"`      // Keep raw to parse into specific structs
+	Error     string          `json:"error,omitempty"`
+}
+
+// JobReport describes how a print job went; it is attached to every
+// printed / print_failed message so the server can match it to the order.
+type JobReport struct {
+	JobID         string `json:"job_id,omitempty"`
+	Copies        int    `json:"copies"`
+	CopiesPrinted int    `json:"copies_printed"`
+	BytesSent     int    `json:"bytes_sent"`
+	Attempts      int    `json:"attempts"`
+	RenderMs      int64  `json:"render_ms"`
+	PrintMs       int64  `json:"print_ms"`
+	PrinterStatus string `json:"printer_status,omitempty"`
+	Duplicate     bool   `json:"duplicate,omitempty"`
+	ReroutedFrom  string `json:"rerouted_from,omitempty"` // Agent key of the printer that failed
+}
+
+type WSMessageTypePrinted struct {
+	Type     MessageType `json:"type"`
+	AgentKey string      `json:"agent_key"`
+	OrderID  int         `json:"order_id"`
+	JobReport
 }
 
 type WSMessageTypePrintFailed struct {
@@ -29,9 +72,54 @@ type WSMessageTypePrintFailed struct {
 	AgentKey string      `json:"agent_key"`
 	OrderID  int         `json:"order_id"`
 	Error    string      `json:"error"`
+	JobReport
+}
+
+// WSMessageTypeRerouted tells the server a job was handed over to the
+// fallback printer; the fallback later reports printed / print_failed.
+type WSMessageTypeRerouted struct {
+	Type             MessageType `json:"type"`
+	AgentKey         string      `json:"agent_key"`
+	OrderID          int         `json:"order_id"`
+	FallbackAgentKey string      `json:"fallback_agent_key"`
+	Reason           string      `json:"reason"`
+	JobReport
+}
+
+// RouteReport describes the part of an order sent to one printer.
+type RouteReport struct {
+	AgentKey   string   `json:"agent_key"`
+	Printer    string   `json:"printer"`
+	JobID      string   `json:"job_id,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	Items      int      `json:"items"`
+}
+
+// WSMessageTypeRouted tells the server how an order was split across printers.
+// Each printer then reports printed / print_failed for its own part.
+type WSMessageTypeRouted struct {
+	Type     MessageType   `json:"type"`
+	AgentKey string        `json:"agent_key"`
+	OrderID  int           `json:"order_id"`
+	Routes   []RouteReport `json:"routes"`
 }
 
 type WSMessageTypePong struct {
 	Type      MessageType `json:"type"`
 	Timestamp int64       `json:"timestamp"`
 }
+
+// WSMessageTypePrinterStatus is the health report of a printer, sent on a
+// schedule and whenever something changes.
+type WSMessageTypePrinterStatus struct {
+	Type          MessageType   `json:"type"`
+	AgentKey      string        `json:"agent_key"`
+	Reachable     bool          `json:"reachable"`
+	PrinterStatus string        `json:"printer_status"`
+	Paused        bool          `json:"paused"`
+	State         *PrinterState `json:"state,omitempty"` // nil if the printer does not report ESC/POS status
+	QueueDepth    int           `json:"queue_depth"`
+	LastPrintedAt *time.Time    `json:"last_printed_at,omitempty"`
+	AgentVersion  string        `json:"agent_version"`
+	Timestamp     int64         `json:"timestamp"`
+}
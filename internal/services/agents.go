@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+// --- Agents ---
+
+// AgentSet is the printers and config the agents run with. Sending a new set
+// to RunAgents applies it without restarting the process.
+type AgentSet struct {
+	Printers []model.Printer
+	Config   model.Config
+	Disabled []string // agent keys of configured printers that are turned off
+}
+
+// runningAgent is an agent with its own context, so it can be stopped on its
+// own when its printer is removed or changed.
+type runningAgent struct {
+	agent *printAgent
+	ctx   context.Context
+	stop  context.CancelFunc
+	done  chan struct{} // closed once the worker (and own connection) stopped
+}
+
+// run waits for the agent to stop, keeping a dedicated connection when connect is set.
+func (r *runningAgent) run(connect bool) {
+	defer close(r.done)
+	if connect {
+		runAgentConnection(r.ctx, r.agent)
+	}
+	<-r.agent.workerDone
+	unregisterAgent(r.agent)
+
+	// A removed printer has handed its jobs over: only undelivered reports are kept
+	if a := r.agent; a.retiring.Load() && a.queueDir != "" {
+		if err := RemovePrinterFiles(a.queueDir, a.printer.AgentKey); err != nil {
+			log.Printf("[%s] Warning: %v", a.printer.Name, err)
+		}
+	}
+}
+
+// agentSupervisor owns the running agents and applies new sets to them.
+type agentSupervisor struct {
+	ctx     context.Context
+	config  model.Config
+	running map[string]*runningAgent // by agent key
+
+	// Multiplexed mode: the shared connection of the current agents
+	muxStop context.CancelFunc
+	muxDone chan struct{}
+}
+
+// RunAgents starts an agent for every printer and connects them to the
+// server using the configured connection mode. Each set received on updates
+// replaces the running one: agents are started for new printers, stopped for
+// removed ones and reconnected when their settings change. Queued jobs stay
+// on disk meanwhile and are resumed by the new agent; a disabled printer
+// keeps them until enabled again, while those of a removed printer go to its
+// fallback or are reported as failed. It returns after ctx
+// is cancelled and every agent has finished its in-progress job.
+func RunAgents(ctx context.Context, printers []model.Printer, config model.Config, updates <-chan AgentSet) {
+	s := &agentSupervisor{ctx: ctx, running: make(map[string]*runningAgent)}
+	s.start(printers, config)
+	defer s.stopAll()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case set := <-updates:
+			s.apply(set)
+		}
+	}
+}
+
+func (s *agentSupervisor) multiplexed() bool {
+	return strings.ToLower(strings.TrimSpace(s.config.ConnectionMode)) == model.ConnectionModeMultiplexed
+}
+
+// start launches agents for every printer not running yet.
+func (s *agentSupervisor) start(printers []model.Printer, config model.Config) {
+	s.config = config
+	ctx := context.WithValue(s.ctx, model.ContextAPIURL, config.ApiUrl)
+	ctx = context.WithValue(ctx, model.ContextWSURL, config.WsUrl)
+
+	// A multiplexed connection registers every key at once, so it always starts from scratch
+	var muxCtx context.Context
+	if s.multiplexed() {
+		muxCtx, s.muxStop = context.WithCancel(ctx)
+		ctx = muxCtx
+	}
+
+	var started []*runningAgent
+	for _, p := range printers {
+		if _, ok := s.running[p.AgentKey]; ok {
+			continue
+		}
+		agentCtx, stop := context.WithCancel(ctx)
+		agent, err := newPrintAgent(agentCtx, p, config)
+		if err != nil {
+			stop()
+			log.Printf("[%s] %v", p.Name, err)
+			continue
+		}
+		registerAgent(agent)
+		r := &runningAgent{agent: agent, ctx: agentCtx, stop: stop, done: make(chan struct{})}
+		s.running[p.AgentKey] = r
+		started = append(started, r)
+	}
+	s.validateFallbacks()
+
+	if muxCtx == nil {
+		for _, r := range started {
+			go r.run(true)
+		}
+		return
+	}
+
+	for _, r := range started {
+		go r.run(false)
+	}
+	s.muxDone = make(chan struct{})
+	go runMultiplexedAgents(muxCtx, started, config, s.muxDone)
+}
+
+// runMultiplexedAgents keeps the shared connection, falling back to one
+// connection per printer when the server does not support multiplexing.
+func runMultiplexedAgents(ctx context.Context, started []*runningAgent, config model.Config, done chan struct{}) {
+	defer close(done)
+	if len(started) == 0 {
+		return
+	}
+
+	agents := make([]*printAgent, len(started))
+	for i, r := range started {
+		agents[i] = r.agent
+	}
+	err := runMultiplexed(ctx, agents, config)
+	if !errors.Is(err, errMultiplexUnsupported) {
+		return
+	}
+	log.Printf("[mux] %v. Falling back to one connection per printer.", err)
+
+	var wg sync.WaitGroup
+	for _, r := range started {
+		wg.Add(1)
+		go func(r *runningAgent) {
+			defer wg.Done()
+			runAgentConnection(r.ctx, r.agent)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// apply moves the running agents to a new set.
+func (s *agentSupervisor) apply(set AgentSet) {
+	wanted := make(map[string]model.Printer, len(set.Printers))
+	for _, p := range set.Printers {
+		wanted[p.AgentKey] = p
+	}
+
+	configChanged := !reflect.DeepEqual(s.config, set.Config)
+	if !configChanged && !s.changed(wanted) {
+		return
+	}
+
+	disabled := make(map[string]bool, len(set.Disabled))
+	for _, key := range set.Disabled {
+		disabled[key] = true
+	}
+
+	// Removed printers stop first, while their fallback can still take their jobs
+	var retired []*runningAgent
+	for key, r := range s.running {
+		if _, ok := wanted[key]; ok {
+			continue
+		}
+		if disabled[key] {
+			log.Printf("[%s] Disabled, stopping. Its queued jobs print once it is enabled again.", r.agent.printer.Name)
+		} else {
+			log.Printf("[%s] Removed, stopping.", r.agent.printer.Name)
+			r.agent.retiring.Store(true)
+		}
+		retired = append(retired, s.stopAgent(key))
+	}
+	waitStopped(retired)
+
+	// Config is shared by every agent, and so is a multiplexed connection: restart them all
+	if configChanged || s.multiplexed() {
+		log.Printf("[reload] Restarting %d agent(s) to apply the changes...", len(s.running))
+		s.stopAll()
+		s.start(set.Printers, set.Config)
+		log.Printf("[reload] Running %d printer(s).", len(s.running))
+		return
+	}
+
+	var changed []*runningAgent
+	for key, r := range s.running {
+		if p := wanted[key]; p != r.agent.printer {
+			log.Printf("[%s] Settings changed, reconnecting.", p.Name)
+			changed = append(changed, s.stopAgent(key))
+		}
+	}
+	waitStopped(changed)
+
+	for key, p := range wanted {
+		if _, ok := s.running[key]; !ok {
+			log.Printf("[%s] Starting agent.", p.Name)
+		}
+	}
+	s.start(set.Printers, set.Config)
+}
+
+// changed reports whether the wanted printers differ from the running ones.
+func (s *agentSupervisor) changed(wanted map[string]model.Printer) bool {
+	if len(wanted) != len(s.running) {
+		return true
+	}
+	for key, r := range s.running {
+		if p, ok := wanted[key]; !ok || p != r.agent.printer {
+			return true
+		}
+	}
+	return false
+}
+
+// stopAgent asks an agent to finish its in-progress job and disconnect, and
+// forgets it. It stops receiving rerouted jobs right away.
+func (s *agentSupervisor) stopAgent(key string) *runningAgent {
+	r := s.running[key]
+	unregisterAgent(r.agent)
+	r.stop()
+	delete(s.running, key)
+	return r
+}
+
+func waitStopped(agents []*runningAgent) {
+	for _, r := range agents {
+		<-r.done
+	}
+}
+
+func (s *agentSupervisor) stopAll() {
+	var stopping []*runningAgent
+	for key := range s.running {
+		stopping = append(stopping, s.stopAgent(key))
+	}
+	if s.muxStop != nil {
+		s.muxStop()
+	}
+	waitStopped(stopping)
+	if s.muxDone != nil {
+		<-s.muxDone
+	}
+	s.muxStop, s.muxDone = nil, nil
+}
+
+func (s *agentSupervisor) validateFallbacks() {
+	agents := make([]*printAgent, 0, len(s.running))
+	for _, r := range s.running {
+		agents = append(agents, r.agent)
+	}
+	validateFallbacks(agents)
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	defaultRenderConcurrency = 2
+	maxRenderConcurrency     = 8 // every tab holds a rendered page in memory
+	browserHealthInterval    = 30 * time.Second
+	browserHealthTimeout     = 10 * time.Second
+)
+
+// --- Headless Chrome Pool ---
+
+// BrowserPool keeps a single headless Chrome process alive and hands out a
+// bounded number of reusable tabs, so rendering never spawns one browser per order.
+type BrowserPool struct {
+	size int
+	sem  chan struct{}
+	idle chan *browserTab
+
+	mu            sync.Mutex
+	allocCancel   context.CancelFunc
+	browserCtx    context.Context
+	browserCancel context.CancelFunc
+	generation    int
+
+	stop chan struct{}
+	once sync.Once
+}
+
+type browserTab struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	generation int
+}
+
+// errBrowserClosed is returned for renders arriving after shutdown closed the browser.
+var errBrowserClosed = errors.New("browser is shut down")
+
+var (
+	sharedPoolMu      sync.Mutex
+	sharedPool        *BrowserPool
+	sharedPoolClosed  bool
+	renderConcurrency = defaultRenderConcurrency
+)
+
+// SetRenderConcurrency sets how many tickets the shared browser renders at
+// the same time: 0 is the default, more than maxRenderConcurrency is capped.
+// It applies when the browser is started.
+func SetRenderConcurrency(size int) {
+	switch {
+	case size < 1:
+		size = defaultRenderConcurrency
+	case size > maxRenderConcurrency:
+		log.Printf("[browser] Render concurrency %d is too high, using %d", size, maxRenderConcurrency)
+		size = maxRenderConcurrency
+	}
+
+	sharedPoolMu.Lock()
+	defer sharedPoolMu.Unlock()
+	renderConcurrency = size
+}
+
+// StartBrowserPool launches the shared browser used by every agent, unless
+// it is already running. Once CloseBrowserPool was called it is never
+// started again.
+func StartBrowserPool() (*BrowserPool, error) {
+	sharedPoolMu.Lock()
+	defer sharedPoolMu.Unlock()
+	if sharedPoolClosed {
+		return nil, errBrowserClosed
+	}
+	if sharedPool == nil {
+		sharedPool = NewBrowserPool(renderConcurrency)
+	}
+	return sharedPool, nil
+}
+
+// CloseBrowserPool stops the shared browser, whether it was started at
+// startup or later by the first ticket that needed it.
+func CloseBrowserPool() {
+	sharedPoolMu.Lock()
+	defer sharedPoolMu.Unlock()
+	sharedPoolClosed = true
+	if sharedPool != nil {
+		sharedPool.Close()
+		sharedPool = nil
+	}
+}
+
+func getBrowserPool() (*BrowserPool, error) {
+	return StartBrowserPool()
+}
+
+func NewBrowserPool(size int) *BrowserPool {
+	if size < 1 {
+		size = defaultRenderConcurrency
+	}
+	bp := &BrowserPool{
+		size: size,
+		sem:  make(chan struct{}, size),
+		idle: make(chan *browserTab, size),
+		stop: make(chan struct{}),
+	}
+	if err := bp.restart(0); err != nil {
+		log.Printf("[browser] Initial start failed, will retry on health check: %v", err)
+	}
+	go bp.healthLoop()
+	return bp
+}
+
+func browserAllocatorOptions() []chromedp.ExecAllocatorOption {
+	opts := append([]chromedp.ExecAllocatorOption{}, chromedp.DefaultExecAllocatorOptions[:]...)
+
+	// macOS: force Chrome path
+	if runtime.GOOS == "darwin" {
+		opts = append(opts,
+			chromedp.ExecPath("/Applications/Google Chrome.app/Contents/MacOS/Google Chrome"),
+			chromedp.Flag("no-sandbox", true),
+			chromedp.Flag("disable-gpu", true),
+		)
+	}
+	return opts
+}
+
+// restart kills the current browser (if any) and launches a fresh one.
+// Tabs belonging to the previous generation are discarded on next use.
+// seen is the generation found dead: if another caller restarted the browser
+// since then, the new one is kept.
+func (bp *BrowserPool) restart(seen int) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	if bp.generation != seen {
+		return nil
+	}
+	if bp.closed() {
+		return errBrowserClosed
+	}
+
+	if bp.browserCancel != nil {
+		bp.browserCancel()
+	}
+	if bp.allocCancel != nil {
+		bp.allocCancel()
+	}
+
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), browserAllocatorOptions()...)
+	browserCtx, browserCancel := chromedp.NewContext(allocCtx)
+
+	bp.allocCancel = allocCancel
+	bp.browserCtx = browserCtx
+	bp.browserCancel = browserCancel
+	bp.generation++
+
+	// Running with no actions starts the browser process
+	if err := chromedp.Run(browserCtx); err != nil {
+		return fmt.Errorf("failed to start browser: %w", err)
+	}
+	log.Printf("[browser] Chrome started (generation %d, %d tabs)", bp.generation, bp.size)
+	return nil
+}
+
+func (bp *BrowserPool) healthLoop() {
+	ticker := time.NewTicker(browserHealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bp.stop:
+			return
+		case <-ticker.C:
+			if generation, err := bp.ping(); err != nil {
+				log.Printf("[browser] Health check failed: %v. Restarting Chrome...", err)
+				if err := bp.restart(generation); err != nil {
+					log.Printf("[browser] Restart failed: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// ping checks the browser and returns the generation it checked.
+func (bp *BrowserPool) ping() (int, error) {
+	bp.mu.Lock()
+	generation := bp.generation
+	browserCtx := bp.browserCtx
+	bp.mu.Unlock()
+
+	if browserCtx == nil || browserCtx.Err() != nil {
+		return generation, fmt.Errorf("browser context closed")
+	}
+
+	tabCtx, cancel := chromedp.NewContext(browserCtx)
+	defer cancel()
+	tabCtx, timeoutCancel := context.WithTimeout(tabCtx, browserHealthTimeout)
+	defer timeoutCancel()
+
+	return generation, chromedp.Run(tabCtx, chromedp.Navigate("about:blank"))
+}
+
+func (bp *BrowserPool) closed() bool {
+	select {
+	case <-bp.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// acquire blocks until a render slot is free and returns a tab to use.
+func (bp *BrowserPool) acquire(ctx context.Context) (*browserTab, error) {
+	if bp.closed() {
+		return nil, errBrowserClosed
+	}
+	select {
+	case bp.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	bp.mu.Lock()
+	generation := bp.generation
+	browserCtx := bp.browserCtx
+	bp.mu.Unlock()
+
+reuse:
+	for {
+		select {
+		case tab := <-bp.idle:
+			if tab.generation == generation && tab.ctx.Err() == nil {
+				return tab, nil
+			}
+			tab.cancel()
+		default:
+			break reuse
+		}
+	}
+
+	// The browser crashed since the last health check: bring it back now
+	if browserCtx == nil || browserCtx.Err() != nil {
+		log.Println("[browser] Chrome is not running, restarting...")
+		if err := bp.restart(generation); err != nil {
+			<-bp.sem
+			return nil, err
+		}
+		bp.mu.Lock()
+		generation = bp.generation
+		browserCtx = bp.browserCtx
+		bp.mu.Unlock()
+	}
+
+	tabCtx, cancel := chromedp.NewContext(browserCtx)
+	return &browserTab{ctx: tabCtx, cancel: cancel, generation: generation}, nil
+}
+
+// release returns the tab to the pool. Broken tabs are closed instead of reused.
+func (bp *BrowserPool) release(tab *browserTab, healthy bool) {
+	defer func() { <-bp.sem }()
+
+	bp.mu.Lock()
+	current := bp.generation
+	bp.mu.Unlock()
+
+	if !healthy || tab.generation != current || tab.ctx.Err() != nil {
+		tab.cancel()
+		return
+	}
+
+	select {
+	case bp.idle <- tab:
+	default:
+		tab.cancel()
+	}
+}
+
+// Close shuts down every tab and the browser process.
+func (bp *BrowserPool) Close() {
+	bp.once.Do(func() {
+		close(bp.stop)
+
+	drain:
+		for {
+			select {
+			case tab := <-bp.idle:
+				tab.cancel()
+			default:
+				break drain
+			}
+		}
+
+		bp.mu.Lock()
+		defer bp.mu.Unlock()
+		if bp.browserCancel != nil {
+			bp.browserCancel()
+		}
+		if bp.allocCancel != nil {
+			bp.allocCancel()
+		}
+		log.Println("[browser] Chrome stopped.")
+	})
+}
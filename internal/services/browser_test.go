@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSetRenderConcurrency(t *testing.T) {
+	t.Cleanup(func() { SetRenderConcurrency(0) })
+
+	for size, want := range map[int]int{-1: defaultRenderConcurrency, 0: defaultRenderConcurrency, 1: 1, 4: 4, maxRenderConcurrency: maxRenderConcurrency, 100: maxRenderConcurrency} {
+		SetRenderConcurrency(size)
+		sharedPoolMu.Lock()
+		got := renderConcurrency
+		sharedPoolMu.Unlock()
+		if got != want {
+			t.Errorf("SetRenderConcurrency(%d) = %d tabs, want %d", size, got, want)
+		}
+	}
+}
+
+func TestBrowserPoolAfterClose(t *testing.T) {
+	// A pool that never launched Chrome, as if its start had failed
+	pool := &BrowserPool{size: 1, sem: make(chan struct{}, 1), idle: make(chan *browserTab, 1), stop: make(chan struct{})}
+	sharedPoolMu.Lock()
+	sharedPool = pool
+	sharedPoolMu.Unlock()
+	t.Cleanup(func() {
+		sharedPoolMu.Lock()
+		sharedPool, sharedPoolClosed = nil, false
+		sharedPoolMu.Unlock()
+	})
+
+	CloseBrowserPool()
+
+	// A late render must not start Chrome again
+	if _, err := getBrowserPool(); !errors.Is(err, errBrowserClosed) {
+		t.Fatalf("getBrowserPool after close = %v, want errBrowserClosed", err)
+	}
+	if _, err := pool.acquire(context.Background()); !errors.Is(err, errBrowserClosed) {
+		t.Fatalf("acquire after close = %v, want errBrowserClosed", err)
+	}
+	if err := pool.restart(pool.generation); !errors.Is(err, errBrowserClosed) {
+		t.Fatalf("restart after close = %v, want errBrowserClosed", err)
+	}
+	sharedPoolMu.Lock()
+	defer sharedPoolMu.Unlock()
+	if sharedPool != nil {
+		t.Fatal("shared pool kept after close")
+	}
+}
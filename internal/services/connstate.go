@@ -0,0 +1,100 @@
+package services
+
+import (
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+const (
+	reconnectBaseDelay = 1 * time.Second
+	reconnectMaxDelay  = 2 * time.Minute
+)
+
+// --- Reconnect Backoff ---
+
+// backoff computes reconnect delays: exponential growth capped at max, with
+// "equal jitter" (half fixed, half random) so agents across restaurants do
+// not reconnect in lockstep after a server restart.
+type backoff struct {
+	base    time.Duration
+	max     time.Duration
+	attempt int
+}
+
+func newBackoff() *backoff {
+	return &backoff{base: reconnectBaseDelay, max: reconnectMaxDelay}
+}
+
+func (b *backoff) Next() time.Duration {
+	delay := b.base
+	for i := 0; i < b.attempt && delay < b.max; i++ {
+		delay *= 2
+	}
+	if delay > b.max {
+		delay = b.max
+	}
+	b.attempt++
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Reset starts again from the base delay. Only called once the server
+// confirmed the registration, so flapping connections keep backing off.
+func (b *backoff) Reset() {
+	b.attempt = 0
+}
+
+// --- Connection State ---
+
+// The state of each printer is also written next to its queue, so the CLI
+// (a separate process) can show it.
+
+var (
+	connStatesMu sync.RWMutex
+	connStates   = make(map[string]model.ConnectionState) // by agent key
+)
+
+func (a *printAgent) setState(state model.ConnectionState) {
+	connStatesMu.Lock()
+	prev := connStates[a.printer.AgentKey]
+	connStates[a.printer.AgentKey] = state
+	connStatesMu.Unlock()
+
+	if prev != state {
+		log.Printf("[%s] Connection state: %s -> %s", a.printer.Name, stateName(prev), state)
+		if a.queueDir != "" && !a.retiring.Load() {
+			if err := os.WriteFile(connStateFile(a.queueDir, a.printer.AgentKey), []byte(string(state)+"\n"), 0644); err != nil {
+				log.Printf("[%s] Warning: Failed to save connection state: %v", a.printer.Name, err)
+			}
+		}
+	}
+}
+
+func connStateFile(dir string, agentKey string) string {
+	return filepath.Join(dir, agentKey+".conn")
+}
+
+// ReadConnectionState returns the last connection state saved by the agent
+// of a printer. It is only current while an agent is running.
+func ReadConnectionState(dir string, agentKey string) model.ConnectionState {
+	data, err := os.ReadFile(connStateFile(dir, agentKey))
+	if err != nil {
+		return model.ConnStateDisconnected
+	}
+	return stateName(model.ConnectionState(strings.TrimSpace(string(data))))
+}
+
+func stateName(state model.ConnectionState) model.ConnectionState {
+	if state == "" {
+		return model.ConnStateDisconnected
+	}
+	return state
+}
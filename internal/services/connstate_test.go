@@ -0,0 +1,72 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+func TestBackoffBounds(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration // delay before jitter
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{6, 64 * time.Second},
+		{7, reconnectMaxDelay},
+		{50, reconnectMaxDelay},
+	}
+	for _, tt := range tests {
+		// Jitter is random: sample it a few times
+		for i := 0; i < 20; i++ {
+			b := newBackoff()
+			b.attempt = tt.attempt
+			if got := b.Next(); got < tt.want/2 || got > tt.want {
+				t.Fatalf("attempt %d: Next = %s, want between %s and %s", tt.attempt, got, tt.want/2, tt.want)
+			}
+			if b.attempt != tt.attempt+1 {
+				t.Fatalf("attempt %d: counter = %d after Next", tt.attempt, b.attempt)
+			}
+		}
+	}
+}
+
+func TestBackoffReset(t *testing.T) {
+	b := newBackoff()
+	for i := 0; i < 10; i++ {
+		b.Next()
+	}
+	b.Reset()
+	if got := b.Next(); got < reconnectBaseDelay/2 || got > reconnectBaseDelay {
+		t.Fatalf("Next after Reset = %s, want at most %s", got, reconnectBaseDelay)
+	}
+}
+
+func TestConnectionStateFile(t *testing.T) {
+	a := newTestAgent(t, model.Printer{Name: "Kitchen", AgentKey: "state-k1"})
+	t.Cleanup(func() {
+		connStatesMu.Lock()
+		delete(connStates, "state-k1")
+		connStatesMu.Unlock()
+	})
+
+	if got := ReadConnectionState(a.queueDir, "state-k1"); got != model.ConnStateDisconnected {
+		t.Fatalf("state before the agent ran = %s, want %s", got, model.ConnStateDisconnected)
+	}
+	for _, state := range []model.ConnectionState{model.ConnStateConnecting, model.ConnStateRegistering, model.ConnStateRegistered, model.ConnStateBackingOff} {
+		a.setState(state)
+		if got := ReadConnectionState(a.queueDir, "state-k1"); got != state {
+			t.Fatalf("saved state = %s, want %s", got, state)
+		}
+	}
+
+	// A removed printer does not bring back its deleted state file
+	a.retiring.Store(true)
+	a.setState(model.ConnStateDisconnected)
+	if got := ReadConnectionState(a.queueDir, "state-k1"); got != model.ConnStateBackingOff {
+		t.Fatalf("state of a retiring agent = %s, want the file untouched", got)
+	}
+}
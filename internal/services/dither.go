@@ -0,0 +1,120 @@
+package services
+
+import (
+	"image"
+	"strings"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+// --- DITHERING ---
+
+// bayer4x4 is the classic ordered-dither threshold map (values 0..15)
+var bayer4x4 = [4][4]float64{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// errorDiffusion describes how the quantization error of a pixel is spread
+// over its not-yet-processed neighbours.
+type errorDiffusion struct {
+	dx, dy int
+	weight float64
+}
+
+var floydSteinbergKernel = []errorDiffusion{
+	{1, 0, 7.0 / 16}, {-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16},
+}
+
+// Atkinson only diffuses 6/8 of the error, which keeps highlights clean
+var atkinsonKernel = []errorDiffusion{
+	{1, 0, 1.0 / 8}, {2, 0, 1.0 / 8},
+	{-1, 1, 1.0 / 8}, {0, 1, 1.0 / 8}, {1, 1, 1.0 / 8},
+	{0, 2, 1.0 / 8},
+}
+
+// normalizeDithering maps a configured algorithm name to a known constant.
+// Unknown or empty values fall back to a plain threshold.
+func normalizeDithering(mode string) string {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case model.DitherFloydSteinberg, "floyd", "fs":
+		return model.DitherFloydSteinberg
+	case model.DitherAtkinson:
+		return model.DitherAtkinson
+	case model.DitherBayer, "ordered":
+		return model.DitherBayer
+	default:
+		return model.DitherThreshold
+	}
+}
+
+// toGrayscale returns the luminance (0 = black, 255 = white) of every pixel.
+// Transparent pixels are composited over white paper.
+func toGrayscale(img image.Image, width, height int) []float64 {
+	bounds := img.Bounds()
+	gray := make([]float64, width*height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			// ITU-R BT.601 luma weights on premultiplied 16-bit channels
+			lum := 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			lum += float64(0xFFFF - a)
+			gray[y*width+x] = lum / 0xFFFF * 255
+		}
+	}
+	return gray
+}
+
+// ditherImage converts grayscale values into 1-bit pixels (true = black dot).
+func ditherImage(gray []float64, width, height int, mode string) []bool {
+	dots := make([]bool, width*height)
+
+	switch normalizeDithering(mode) {
+	case model.DitherFloydSteinberg:
+		diffuseError(gray, dots, width, height, floydSteinbergKernel)
+	case model.DitherAtkinson:
+		diffuseError(gray, dots, width, height, atkinsonKernel)
+	case model.DitherBayer:
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				threshold := (bayer4x4[y%4][x%4] + 0.5) * 16
+				dots[y*width+x] = gray[y*width+x] < threshold
+			}
+		}
+	default:
+		for i, v := range gray {
+			dots[i] = v < 128
+		}
+	}
+	return dots
+}
+
+func diffuseError(gray []float64, dots []bool, width, height int, kernel []errorDiffusion) {
+	// Work on a copy so the caller's buffer is left untouched
+	buf := make([]float64, len(gray))
+	copy(buf, gray)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			old := buf[i]
+			value := 255.0
+			if old < 128 {
+				value = 0
+				dots[i] = true
+			}
+			quantErr := old - value
+
+			for _, k := range kernel {
+				nx, ny := x+k.dx, y+k.dy
+				if nx < 0 || nx >= width || ny >= height {
+					continue
+				}
+				buf[ny*width+nx] += quantErr * k.weight
+			}
+		}
+	}
+}
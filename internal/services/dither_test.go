@@ -0,0 +1,100 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+func TestNormalizeDithering(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"", model.DitherThreshold},
+		{"threshold", model.DitherThreshold},
+		{"unknown", model.DitherThreshold},
+		{"floyd-steinberg", model.DitherFloydSteinberg},
+		{" FS ", model.DitherFloydSteinberg},
+		{"Floyd", model.DitherFloydSteinberg},
+		{"atkinson", model.DitherAtkinson},
+		{"ordered", model.DitherBayer},
+		{"bayer", model.DitherBayer},
+	}
+	for _, tt := range tests {
+		if got := normalizeDithering(tt.mode); got != tt.want {
+			t.Errorf("normalizeDithering(%q) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestToGrayscale(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	img.Set(0, 0, color.NRGBA{255, 255, 255, 255})
+	img.Set(1, 0, color.NRGBA{0, 0, 0, 255})
+	img.Set(2, 0, color.NRGBA{0, 0, 0, 0}) // transparent: white paper
+	img.Set(3, 0, color.NRGBA{255, 0, 0, 255})
+
+	want := []float64{255, 0, 255, 0.299 * 255}
+	got := toGrayscale(img, 4, 1)
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 0.5 {
+			t.Errorf("pixel %d = %.1f, want %.1f", i, got[i], want[i])
+		}
+	}
+}
+
+func uniformGray(width, height int, value float64) []float64 {
+	gray := make([]float64, width*height)
+	for i := range gray {
+		gray[i] = value
+	}
+	return gray
+}
+
+func countDots(dots []bool) int {
+	n := 0
+	for _, dot := range dots {
+		if dot {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDitherImageExtremes(t *testing.T) {
+	const width, height = 16, 16
+	for _, mode := range []string{model.DitherThreshold, model.DitherFloydSteinberg, model.DitherAtkinson, model.DitherBayer} {
+		if n := countDots(ditherImage(uniformGray(width, height, 255), width, height, mode)); n != 0 {
+			t.Errorf("%s: white page has %d dots, want 0", mode, n)
+		}
+		if n := countDots(ditherImage(uniformGray(width, height, 0), width, height, mode)); n != width*height {
+			t.Errorf("%s: black page has %d dots, want %d", mode, n, width*height)
+		}
+	}
+}
+
+func TestDitherImageMidGray(t *testing.T) {
+	const width, height = 32, 32
+	tests := []struct {
+		mode     string
+		min, max int // dots expected on a 50% gray page
+	}{
+		{model.DitherThreshold, width * height, width * height}, // 127 is below the threshold
+		{model.DitherFloydSteinberg, width * height * 45 / 100, width * height * 55 / 100},
+		{model.DitherBayer, width * height / 2, width * height / 2},
+	}
+	for _, tt := range tests {
+		gray := uniformGray(width, height, 127)
+		n := countDots(ditherImage(gray, width, height, tt.mode))
+		if n < tt.min || n > tt.max {
+			t.Errorf("%s: %d dots, want between %d and %d", tt.mode, n, tt.min, tt.max)
+		}
+		if gray[0] != 127 || gray[len(gray)-1] != 127 {
+			t.Errorf("%s: input grayscale was modified", tt.mode)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+// --- ESC/POS TEXT MODE ---
+
+const (
+	alignLeft   byte = 0
+	alignCenter byte = 1
+	alignRight  byte = 2
+)
+
+// escposBuilder accumulates native ESC/POS commands for a text ticket.
+type escposBuilder struct {
+	buf      bytes.Buffer
+	codePage string
+	columns  int
+}
+
+func newESCPOSBuilder(p model.Printer) *escposBuilder {
+	b := &escposBuilder{
+		codePage: normalizeCodePage(p.CodePage),
+		columns:  printerColumns(p),
+	}
+	b.buf.Write([]byte{0x1B, 0x40}) // ESC @ - initialize
+	b.buf.Write([]byte{0x1B, 0x74, codePageTable[b.codePage].number})
+	return b
+}
+
+// printerColumns returns how many Font A characters fit on one line.
+func printerColumns(p model.Printer) int {
+	if p.Size <= 0 {
+		return 48
+	}
+	return p.Size / 12
+}
+
+func (b *escposBuilder) Align(a byte) *escposBuilder {
+	b.buf.Write([]byte{0x1B, 0x61, a}) // ESC a n
+	return b
+}
+
+func (b *escposBuilder) Bold(on bool) *escposBuilder {
+	b.buf.Write([]byte{0x1B, 0x45, boolByte(on)}) // ESC E n
+	return b
+}
+
+// Size sets the character magnification (1..8) for width and height.
+func (b *escposBuilder) Size(width, height int) *escposBuilder {
+	n := byte((clampInt(width, 1, 8)-1)<<4 | (clampInt(height, 1, 8) - 1))
+	b.buf.Write([]byte{0x1D, 0x21, n}) // GS ! n
+	return b
+}
+
+func (b *escposBuilder) Text(s string) *escposBuilder {
+	b.buf.Write(encodeForCodePage(s, b.codePage))
+	return b
+}
+
+func (b *escposBuilder) Line(s string) *escposBuilder {
+	return b.Text(s).Newline()
+}
+
+func (b *escposBuilder) Newline() *escposBuilder {
+	b.buf.WriteByte('\n')
+	return b
+}
+
+func (b *escposBuilder) Separator() *escposBuilder {
+	return b.Line(strings.Repeat("-", b.columns))
+}
+
+func (b *escposBuilder) Feed(lines int) *escposBuilder {
+	b.buf.Write([]byte{0x1B, 0x64, byte(clampInt(lines, 0, 255))}) // ESC d n
+	return b
+}
+
+func (b *escposBuilder) Cut() *escposBuilder {
+	b.buf.Write([]byte{0x1D, 0x56, 0x41, 0x00}) // GS V A 0 - partial cut
+	return b
+}
+
+func (b *escposBuilder) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func boolByte(v bool) byte {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// --- HTML -> ESC/POS ---
+
+// textSpan is a run of text sharing the same style inside one printed line.
+type textSpan struct {
+	text string
+	bold bool
+	big  bool
+}
+
+type htmlTextRenderer struct {
+	b     *escposBuilder
+	line  []textSpan
+	align byte
+	bold  int
+	big   int
+	space bool
+}
+
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "header": true, "footer": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"table": true, "tr": true, "ul": true, "ol": true, "li": true, "center": true,
+}
+
+var skippedElements = map[string]bool{
+	"head": true, "style": true, "script": true, "title": true,
+}
+
+// renderHTMLToESCPOS turns the server's ticket HTML into native ESC/POS text
+// commands, keeping headings, bold text and alignment.
+func renderHTMLToESCPOS(htmlContent string, p model.Printer) ([]byte, error) {
+	doc, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	r := &htmlTextRenderer{b: newESCPOSBuilder(p)}
+	r.walk(doc)
+	r.flush()
+
+	r.b.Feed(3).Cut()
+	return r.b.Bytes(), nil
+}
+
+func (r *htmlTextRenderer) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		text := strings.Join(strings.Fields(n.Data), " ")
+		if text == "" {
+			r.space = r.space || n.Data != ""
+			return
+		}
+		// Keep the whitespace between inline elements, collapsed to one space
+		if len(r.line) > 0 && (r.space || startsWithSpace(n.Data)) {
+			text = " " + text
+		}
+		r.space = endsWithSpace(n.Data)
+		r.line = append(r.line, textSpan{text: text, bold: r.bold > 0, big: r.big > 0})
+		return
+
+	case html.ElementNode:
+		tag := n.Data
+		if skippedElements[tag] {
+			return
+		}
+
+		switch tag {
+		case "br":
+			r.flush()
+			return
+		case "hr":
+			r.flush()
+			r.b.Align(alignLeft).Separator()
+			return
+		}
+
+		block := blockElements[tag]
+		prevAlign := r.align
+		if block {
+			r.flush()
+			if a, ok := elementAlign(n); ok {
+				r.align = a
+			}
+		}
+
+		switch tag {
+		case "h1", "h2":
+			r.big++
+			r.bold++
+		case "h3", "h4", "h5", "h6", "b", "strong", "th":
+			r.bold++
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			r.walk(c)
+		}
+
+		switch tag {
+		case "h1", "h2":
+			r.big--
+			r.bold--
+		case "h3", "h4", "h5", "h6", "b", "strong", "th":
+			r.bold--
+		}
+
+		if block {
+			r.flush()
+			r.align = prevAlign
+		}
+		return
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.walk(c)
+	}
+}
+
+// flush prints the pending line with its alignment and styles.
+func (r *htmlTextRenderer) flush() {
+	if len(r.line) == 0 {
+		return
+	}
+
+	r.b.Align(r.align)
+	for _, span := range r.line {
+		r.b.Bold(span.bold)
+		if span.big {
+			r.b.Size(2, 2)
+		} else {
+			r.b.Size(1, 1)
+		}
+		r.b.Text(span.text)
+	}
+	r.b.Bold(false).Size(1, 1).Newline()
+	r.line = nil
+	r.space = false
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.TrimLeft(s, " \t\r\n") != s
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.TrimRight(s, " \t\r\n") != s
+}
+
+// elementAlign reads the alignment from <center>, align="" or an inline style.
+func elementAlign(n *html.Node) (byte, bool) {
+	if n.Data == "center" {
+		return alignCenter, true
+	}
+
+	for _, attr := range n.Attr {
+		value := strings.ToLower(attr.Val)
+		switch attr.Key {
+		case "align":
+			return parseAlign(value)
+		case "style":
+			for _, decl := range strings.Split(value, ";") {
+				parts := strings.SplitN(decl, ":", 2)
+				if len(parts) == 2 && strings.TrimSpace(parts[0]) == "text-align" {
+					return parseAlign(strings.TrimSpace(parts[1]))
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+func parseAlign(value string) (byte, bool) {
+	switch value {
+	case "center":
+		return alignCenter, true
+	case "right":
+		return alignRight, true
+	case "left":
+		return alignLeft, true
+	}
+	return 0, false
+}
+
+// --- CODE PAGES ---
+
+type codePage struct {
+	number byte // ESC t n
+	chars  map[rune]byte
+}
+
+// Characters shared by PC437, PC850 and PC858
+var latinCommon = map[rune]byte{
+	'Ç': 0x80, 'ü': 0x81, 'é': 0x82, 'â': 0x83, 'ä': 0x84, 'à': 0x85, 'ç': 0x87,
+	'ê': 0x88, 'ë': 0x89, 'è': 0x8A, 'ï': 0x8B, 'î': 0x8C, 'ì': 0x8D, 'É': 0x90,
+	'ô': 0x93, 'ö': 0x94, 'û': 0x96, 'ù': 0x97, '£': 0x9C, 'á': 0xA0, 'í': 0xA1,
+	'ó': 0xA2, 'ú': 0xA3, 'ñ': 0xA4, 'Ñ': 0xA5, '°': 0xF8,
+}
+
+var codePageTable = map[string]codePage{
+	model.CodePagePC437: {number: 0, chars: latinCommon},
+	model.CodePagePC850: {number: 2, chars: withChars(latinCommon, map[rune]byte{
+		'À': 0xB7, 'È': 0xD4, 'Ì': 0xDE, 'Ò': 0xE3, 'Ù': 0xEB,
+	})},
+	model.CodePagePC858: {number: 19, chars: withChars(latinCommon, map[rune]byte{
+		'À': 0xB7, 'È': 0xD4, 'Ì': 0xDE, 'Ò': 0xE3, 'Ù': 0xEB, '€': 0xD5,
+	})},
+}
+
+// Used when a character has no slot in the selected code page
+var asciiFallback = map[rune]string{
+	'€': "EUR", '’': "'", '‘': "'", '“': "\"", '”': "\"", '–': "-", '—': "-",
+	'À': "A", 'È': "E", 'Ì': "I", 'Ò': "O", 'Ù': "U", '…': "...",
+	'\u00a0': " ", // &nbsp;
+}
+
+func withChars(base, extra map[rune]byte) map[rune]byte {
+	merged := make(map[rune]byte, len(base)+len(extra))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	return merged
+}
+
+func normalizeCodePage(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, ok := codePageTable[name]; ok {
+		return name
+	}
+	return model.CodePagePC858
+}
+
+// encodeForCodePage converts UTF-8 text to the printer's single-byte code page.
+func encodeForCodePage(s string, page string) []byte {
+	table := codePageTable[normalizeCodePage(page)].chars
+	out := make([]byte, 0, len(s))
+
+	for _, r := range s {
+		switch {
+		case r == '\n' || (r >= 0x20 && r < 0x7F):
+			out = append(out, byte(r))
+		case table[r] != 0:
+			out = append(out, table[r])
+		case asciiFallback[r] != "":
+			out = append(out, asciiFallback[r]...)
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// --- RAW TCP OUTPUT ---
+
+// printerError carries the printer status observed when sending failed.
+type printerError struct {
+	status    string
+	attention bool // the printer needs staff (paper, cover, jam...), retrying won't help soon
+	err       error
+}
+
+func (e *printerError) Error() string { return e.err.Error() }
+func (e *printerError) Unwrap() error { return e.err }
+
+// printerStatusOf returns the printer status to report for a send error.
+func printerStatusOf(err error) string {
+	if err == nil {
+		return model.PrinterStatusOnline
+	}
+	var pe *printerError
+	if errors.As(err, &pe) {
+		return pe.status
+	}
+	return model.PrinterStatusError
+}
+
+// needsAttention reports whether a send error comes from a printer condition
+// only staff can fix.
+func needsAttention(err error) bool {
+	var pe *printerError
+	return errors.As(err, &pe) && pe.attention
+}
+
+// writeToPrinter sends a complete ESC/POS job to the printer via raw TCP
+// and returns the number of bytes written. A paper end seen while printing
+// fails the whole copy: the printer does not tell how much of it came out,
+// so the copy is printed again in full once the paper is replaced.
+func writeToPrinter(ctx context.Context, p model.Printer, printJob []byte) (int, error) {
+	log.Printf("[%s] Sending %d bytes to %s:%d", p.Name, len(printJob), p.IP, p.Port)
+
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(p.IP, strconv.Itoa(p.Port)))
+	if err != nil {
+		observePrinter(p.AgentKey, false, nil)
+		return 0, &printerError{status: model.PrinterStatusUnreachable, err: fmt.Errorf("connection failed: %w", err)}
+	}
+	defer conn.Close()
+
+	// Abort the write if the job is cancelled (shutdown deadline reached)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	status := newStatusReader(conn)
+
+	// Don't send a ticket into a printer that cannot print it
+	state, known := status.Poll()
+	observePrinter(p.AgentKey, true, observedState(state, known))
+	if known {
+		if !state.Ready() {
+			return 0, &printerError{status: state.Status(), attention: state.NeedsAttention(), err: fmt.Errorf("printer not ready: %s", state)}
+		}
+		if state.PaperNearEnd {
+			log.Printf("[%s] Warning: paper near end", p.Name)
+		}
+	}
+
+	if p.StatusBack {
+		if err := setStatusBack(conn, true); err != nil {
+			return 0, &printerError{status: model.PrinterStatusError, err: fmt.Errorf("write failed: %w", err)}
+		}
+		defer setStatusBack(conn, false)
+	}
+
+	n, err := conn.Write(printJob)
+	if err != nil {
+		return n, &printerError{status: model.PrinterStatusError, err: fmt.Errorf("write failed: %w", err)}
+	}
+
+	// Give printer time to process, then check it did not run out of paper
+	sleepContext(ctx, statusSettleDelay)
+
+	if asb, ok := status.ASBState(); ok && asb.PaperEnd {
+		observePrinter(p.AgentKey, true, &asb)
+		return n, &printerError{status: model.PrinterStatusPaperEnd, attention: true, err: fmt.Errorf("printer reported %s while printing", asb)}
+	}
+	silent := status.silent
+	if state, ok := status.Poll(); ok {
+		observePrinter(p.AgentKey, true, &state)
+		if state.PaperEnd {
+			return n, &printerError{status: model.PrinterStatusPaperEnd, attention: true, err: fmt.Errorf("printer reported %s after printing", state)}
+		}
+	} else if known && !silent {
+		log.Printf("[%s] Warning: printer stopped answering status requests after printing", p.Name)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+func TestEncodeForCodePage(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		page string
+		want []byte
+	}{
+		{"ascii", "Table 4\n", model.CodePagePC858, []byte("Table 4\n")},
+		{"accents", "Café", model.CodePagePC437, []byte{'C', 'a', 'f', 0x82}},
+		{"euro in pc858", "€5", model.CodePagePC858, []byte{0xD5, '5'}},
+		{"euro fallback", "€5", model.CodePagePC437, []byte("EUR5")},
+		{"nbsp", "a\u00a0b", model.CodePagePC858, []byte("a b")},
+		{"unknown page is pc858", "€", "pc999", []byte{0xD5}},
+		{"no mapping", "寿司", model.CodePagePC858, []byte("??")},
+		{"control characters", "a\tb", model.CodePagePC858, []byte("a?b")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encodeForCodePage(tt.text, tt.page); !bytes.Equal(got, tt.want) {
+				t.Fatalf("encodeForCodePage(%q, %q) = % x, want % x", tt.text, tt.page, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderHTMLToESCPOS(t *testing.T) {
+	p := model.Printer{Size: 576, CodePage: model.CodePagePC858}
+
+	tests := []struct {
+		name string
+		html string
+		want func(b *escposBuilder)
+	}{
+		{
+			name: "heading is big and bold",
+			html: `<html><head><style>h1{color:red}</style></head><body><h1>Order 12</h1></body></html>`,
+			want: func(b *escposBuilder) {
+				b.Align(alignLeft).Bold(true).Size(2, 2).Text("Order 12").Bold(false).Size(1, 1).Newline()
+			},
+		},
+		{
+			name: "inline bold keeps the space",
+			html: `<p style="text-align: right">Total <b>9,50 €</b></p>`,
+			want: func(b *escposBuilder) {
+				b.Align(alignRight).
+					Bold(false).Size(1, 1).Text("Total").
+					Bold(true).Size(1, 1).Text(" 9,50 €").
+					Bold(false).Size(1, 1).Newline()
+			},
+		},
+		{
+			name: "br and hr break lines",
+			html: `<center>Pizza<br>Pasta</center><hr>`,
+			want: func(b *escposBuilder) {
+				b.Align(alignCenter).Bold(false).Size(1, 1).Text("Pizza").Bold(false).Size(1, 1).Newline()
+				b.Align(alignCenter).Bold(false).Size(1, 1).Text("Pasta").Bold(false).Size(1, 1).Newline()
+				b.Align(alignLeft).Separator()
+			},
+		},
+		{
+			name: "whitespace collapses",
+			html: "<div>  2 x\n\t  Margherita  </div>",
+			want: func(b *escposBuilder) {
+				b.Align(alignLeft).Bold(false).Size(1, 1).Text("2 x Margherita").Bold(false).Size(1, 1).Newline()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderHTMLToESCPOS(tt.html, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := newESCPOSBuilder(p)
+			tt.want(want)
+			want.Feed(3).Cut()
+			if !bytes.Equal(got, want.Bytes()) {
+				t.Fatalf("ticket =\n% x\nwant\n% x", got, want.Bytes())
+			}
+		})
+	}
+}
+
+func TestPrinterColumns(t *testing.T) {
+	for size, want := range map[int]int{0: 48, 576: 48, 384: 32} {
+		if got := printerColumns(model.Printer{Size: size}); got != want {
+			t.Errorf("printerColumns(%d) = %d, want %d", size, got, want)
+		}
+	}
+}
+
+func TestUsesTextRenderer(t *testing.T) {
+	tests := []struct {
+		printer model.Printer
+		want    bool
+	}{
+		{model.Printer{Type: "thermal", Renderer: "text"}, true},
+		{model.Printer{Type: "", Renderer: " Text "}, true},
+		{model.Printer{Type: "thermal", Renderer: ""}, false},
+		{model.Printer{Type: "thermal", Renderer: "image"}, false},
+		{model.Printer{Type: "laser", Renderer: "text"}, false},
+	}
+	for _, tt := range tests {
+		if got := usesTextRenderer(tt.printer); got != tt.want {
+			t.Errorf("usesTextRenderer(type %q, renderer %q) = %v, want %v", tt.printer.Type, tt.printer.Renderer, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+// --- Running Agents ---
+
+var (
+	agentsMu      sync.RWMutex
+	runningAgents = make(map[string]*printAgent) // by agent key
+)
+
+func registerAgent(a *printAgent) {
+	agentsMu.Lock()
+	runningAgents[a.printer.AgentKey] = a
+	agentsMu.Unlock()
+}
+
+func unregisterAgent(a *printAgent) {
+	agentsMu.Lock()
+	if runningAgents[a.printer.AgentKey] == a {
+		delete(runningAgents, a.printer.AgentKey)
+	}
+	agentsMu.Unlock()
+}
+
+// findAgent looks up a running agent by agent key, then by printer name.
+func findAgent(ref string) *printAgent {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil
+	}
+
+	agentsMu.RLock()
+	defer agentsMu.RUnlock()
+
+	if a, ok := runningAgents[ref]; ok {
+		return a
+	}
+	for _, a := range runningAgents {
+		if strings.EqualFold(a.printer.Name, ref) {
+			return a
+		}
+	}
+	return nil
+}
+
+// --- Failover ---
+
+// fallbackAgent returns the backup printer's agent, if one is configured and running.
+func (a *printAgent) fallbackAgent() *printAgent {
+	if a.printer.Fallback == "" {
+		return nil
+	}
+	fb := findAgent(a.printer.Fallback)
+	if fb == nil || fb == a {
+		log.Printf("[%s] Fallback printer %q is not available", a.printer.Name, a.printer.Fallback)
+		return nil
+	}
+	return fb
+}
+
+// reroute hands the copies still missing over to the fallback printer.
+// Jobs are rerouted once at most, so two printers backing each other up
+// cannot bounce a ticket forever. It reports whether the job was handed over.
+func (a *printAgent) reroute(job *model.PrintJob, cause error) bool {
+	if job.ReroutedFromKey != "" {
+		return false
+	}
+	fb := a.fallbackAgent()
+	if fb == nil {
+		return false
+	}
+	p := a.printer
+
+	data := job.Data
+	data.Copies = job.Copies() - job.CopiesPrinted
+
+	now := time.Now()
+	moved := &model.PrintJob{
+		ID:              fmt.Sprintf("%d-%d", job.OrderID, now.UnixNano()),
+		AgentKey:        fb.printer.AgentKey,
+		OrderID:         job.OrderID,
+		Data:            data,
+		Status:          model.JobStatusPending,
+		CreatedAt:       now,
+		NextAttemptAt:   now,
+		Duplicate:       job.Duplicate,
+		ReroutedFrom:    p.Name,
+		ReroutedFromKey: p.AgentKey,
+	}
+	if err := fb.queue.Enqueue(moved); err != nil {
+		log.Printf("[%s] Failed to reroute order %d to %s: %v", p.Name, job.OrderID, fb.printer.Name, err)
+		return false
+	}
+	log.Printf("[%s] Order %d rerouted to %s: %v", p.Name, job.OrderID, fb.printer.Name, cause)
+	fb.notifyStatus()
+
+	a.queue.Update(job, func(j *model.PrintJob) {
+		j.Status = model.JobStatusRerouted
+		j.LastError = cause.Error()
+		j.ReroutedTo = fb.printer.AgentKey
+		j.FinishedAt = now
+	})
+	a.report(job)
+	return true
+}
+
+// handOffPending settles the jobs still waiting when the printer is removed
+// while running: they move to the fallback printer, or are reported as failed
+// so the server knows they will not print here.
+func (a *printAgent) handOffPending() {
+	cause := errors.New("printer removed")
+	for _, job := range a.queue.PendingJobs() {
+		if a.reroute(job, cause) {
+			continue
+		}
+		a.queue.Update(job, func(j *model.PrintJob) {
+			j.Status = model.JobStatusFailed
+			j.LastError = cause.Error()
+			j.FinishedAt = time.Now()
+		})
+		log.Printf("[%s] Order %d not printed: %v", a.printer.Name, job.OrderID, cause)
+		a.report(job)
+	}
+}
+
+// validateFallbacks warns about fallback printers that do not match any agent.
+func validateFallbacks(agents []*printAgent) {
+	for _, a := range agents {
+		if a.printer.Fallback == "" {
+			continue
+		}
+		if fb := findAgent(a.printer.Fallback); fb == nil || fb == a {
+			log.Printf("[%s] Warning: fallback printer %q not found among active printers", a.printer.Name, a.printer.Fallback)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+func enqueueTestJob(t *testing.T, a *printAgent, id string, orderID int) *model.PrintJob {
+	t.Helper()
+	job := &model.PrintJob{ID: id, AgentKey: a.printer.AgentKey, OrderID: orderID, Status: model.JobStatusPending, CreatedAt: time.Now()}
+	if err := a.queue.Enqueue(job); err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+// runTestAgents registers agents for failover lookups until the test ends.
+func runTestAgents(t *testing.T, agents ...*printAgent) {
+	for _, a := range agents {
+		registerAgent(a)
+	}
+	t.Cleanup(func() {
+		for _, a := range agents {
+			unregisterAgent(a)
+		}
+	})
+}
+
+func TestHandOffPending(t *testing.T) {
+	tests := []struct {
+		name       string
+		fallback   string
+		wantStatus model.JobStatus
+		wantMoved  int
+	}{
+		{"to fallback", "Bar", model.JobStatusRerouted, 2},
+		{"no fallback", "", model.JobStatusFailed, 0},
+		{"fallback not running", "Terrace", model.JobStatusFailed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAgent(t, model.Printer{Name: "Kitchen", AgentKey: "k1", Fallback: tt.fallback})
+			bar := newTestAgent(t, model.Printer{Name: "Bar", AgentKey: "k2"})
+			runTestAgents(t, bar)
+
+			enqueueTestJob(t, a, "j1", 1)
+			enqueueTestJob(t, a, "j2", 2)
+			a.handOffPending()
+
+			for _, job := range a.queue.Snapshot() {
+				if job.Status != tt.wantStatus {
+					t.Errorf("order %d status = %s, want %s", job.OrderID, job.Status, tt.wantStatus)
+				}
+			}
+			if moved := bar.queue.Pending(); moved != tt.wantMoved {
+				t.Errorf("fallback queue = %d jobs, want %d", moved, tt.wantMoved)
+			}
+		})
+	}
+}
+
+func TestApplyHandsOffOnlyRemovedPrinters(t *testing.T) {
+	s := &agentSupervisor{ctx: context.Background(), running: make(map[string]*runningAgent)}
+	for _, p := range []model.Printer{{Name: "Kitchen", AgentKey: "k1"}, {Name: "Bar", AgentKey: "k2"}} {
+		done := make(chan struct{})
+		s.running[p.AgentKey] = &runningAgent{agent: newTestAgent(t, p), stop: func() { close(done) }, done: done}
+	}
+	kitchen, bar := s.running["k1"].agent, s.running["k2"].agent
+
+	// Kitchen is gone from the printers file, Bar is only turned off
+	s.apply(AgentSet{Disabled: []string{"k2"}})
+
+	if len(s.running) != 0 {
+		t.Fatalf("%d agents still running, want 0", len(s.running))
+	}
+	if !kitchen.retiring.Load() {
+		t.Error("removed printer does not hand off its jobs")
+	}
+	if bar.retiring.Load() {
+		t.Error("disabled printer hands off its jobs, want them kept in its queue")
+	}
+}
+
+func TestApplyKeepsUndeliveredReportsOfRemovedPrinter(t *testing.T) {
+	a := newTestAgent(t, model.Printer{Name: "Kitchen", AgentKey: "k1"})
+	a.paused.Store(true) // hold the jobs until the printer is removed
+	enqueueTestJob(t, a, "j1", 1)
+	enqueueTestJob(t, a, "j2", 2)
+
+	// No connection: the print_failed reports cannot be sent
+	ctx, stop := context.WithCancel(context.Background())
+	r := &runningAgent{agent: a, ctx: ctx, stop: stop, done: make(chan struct{})}
+	go a.runWorker(ctx)
+	go r.run(false)
+	s := &agentSupervisor{ctx: context.Background(), running: map[string]*runningAgent{"k1": r}}
+	s.apply(AgentSet{})
+
+	queue, err := OpenJobQueue(a.queueDir, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := queue.Unreported()
+	if len(jobs) != 2 {
+		t.Fatalf("queue on disk = %d reports, want 2", len(jobs))
+	}
+	for _, job := range jobs {
+		if job.Status != model.JobStatusFailed {
+			t.Errorf("order %d status = %s, want %s", job.OrderID, job.Status, model.JobStatusFailed)
+		}
+	}
+}
+
+func TestRerouteOnce(t *testing.T) {
+	tests := []struct {
+		name    string
+		kitchen string // fallback of Kitchen
+		bar     string // fallback of Bar
+		wantBar bool   // job handed from Kitchen to Bar
+	}{
+		{"no fallback", "", "", false},
+		{"self", "Kitchen", "", false},
+		{"by agent key", "k2", "", true},
+		{"name is case-insensitive", "bar", "", true},
+		{"chain stops after one hop", "Bar", "Terrace", true},
+		{"cycle does not bounce", "Bar", "Kitchen", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kitchen := newTestAgent(t, model.Printer{Name: "Kitchen", AgentKey: "k1", Fallback: tt.kitchen})
+			bar := newTestAgent(t, model.Printer{Name: "Bar", AgentKey: "k2", Fallback: tt.bar})
+			terrace := newTestAgent(t, model.Printer{Name: "Terrace", AgentKey: "k3"})
+			runTestAgents(t, kitchen, bar, terrace)
+
+			job := enqueueTestJob(t, kitchen, "j1", 1)
+			if got := kitchen.reroute(job, errors.New("paper end")); got != tt.wantBar {
+				t.Fatalf("reroute = %v, want %v", got, tt.wantBar)
+			}
+			if !tt.wantBar {
+				if job.Status != model.JobStatusPending || bar.queue.Pending() != 0 {
+					t.Fatalf("job %s, fallback queue %d, want the job kept", job.Status, bar.queue.Pending())
+				}
+				return
+			}
+
+			moved := bar.queue.PendingJobs()
+			if len(moved) != 1 || moved[0].ReroutedFromKey != "k1" {
+				t.Fatalf("fallback queue = %+v, want the job from k1", moved)
+			}
+			if job.Status != model.JobStatusRerouted || job.ReroutedTo != "k2" {
+				t.Fatalf("original job = %s to %q, want rerouted to k2", job.Status, job.ReroutedTo)
+			}
+			if bar.reroute(moved[0], errors.New("offline")) || kitchen.queue.Pending() != 0 || terrace.queue.Pending() != 0 {
+				t.Fatal("rerouted job was handed on again")
+			}
+		})
+	}
+}
+
+func TestRerouteMovesMissingCopies(t *testing.T) {
+	kitchen := newTestAgent(t, model.Printer{Name: "Kitchen", AgentKey: "k1", Fallback: "Bar"})
+	bar := newTestAgent(t, model.Printer{Name: "Bar", AgentKey: "k2"})
+	runTestAgents(t, kitchen, bar)
+
+	job := &model.PrintJob{ID: "j1", OrderID: 1, Data: model.PrinterData{Copies: 3}, Status: model.JobStatusPending, CopiesPrinted: 1, CreatedAt: time.Now()}
+	if err := kitchen.queue.Enqueue(job); err != nil {
+		t.Fatal(err)
+	}
+	if !kitchen.reroute(job, errors.New("cutter error")) {
+		t.Fatal("job not rerouted")
+	}
+	moved := bar.queue.PendingJobs()
+	if len(moved) != 1 || moved[0].Copies() != 2 || moved[0].ReroutedFrom != "Kitchen" {
+		t.Fatalf("fallback queue = %+v, want 2 copies from Kitchen", moved)
+	}
+}
+
+func TestValidateFallbacks(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback map[string]string // printer name -> fallback
+		warned   []string
+	}{
+		{"none", map[string]string{"Kitchen": "", "Bar": ""}, nil},
+		{"chain", map[string]string{"Kitchen": "Bar", "Bar": "Terrace", "Terrace": ""}, nil},
+		{"cycle", map[string]string{"Kitchen": "Bar", "Bar": "Kitchen"}, nil},
+		{"unknown", map[string]string{"Kitchen": "Patio", "Bar": "Kitchen"}, []string{"Kitchen"}},
+		{"self", map[string]string{"Kitchen": "Kitchen", "Bar": ""}, []string{"Kitchen"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var agents []*printAgent
+			for name, fallback := range tt.fallback {
+				agents = append(agents, newTestAgent(t, model.Printer{Name: name, AgentKey: strings.ToLower(name), Fallback: fallback}))
+			}
+			runTestAgents(t, agents...)
+
+			var out bytes.Buffer
+			log.SetOutput(&out)
+			defer log.SetOutput(os.Stderr)
+			validateFallbacks(agents)
+
+			warnings := strings.Count(out.String(), "Warning: fallback printer")
+			if warnings != len(tt.warned) {
+				t.Fatalf("warnings = %d, want %d:\n%s", warnings, len(tt.warned), out.String())
+			}
+			for _, name := range tt.warned {
+				if !strings.Contains(out.String(), "["+name+"] Warning") {
+					t.Errorf("no warning for %s:\n%s", name, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+const (
+	defaultStatusInterval = 60 * time.Second
+	statusProbeTimeout    = 3 * time.Second
+)
+
+// --- Printer Health Reporting ---
+
+func (a *printAgent) statusInterval() time.Duration {
+	if a.config.StatusIntervalSeconds > 0 {
+		return time.Duration(a.config.StatusIntervalSeconds) * time.Second
+	}
+	return defaultStatusInterval
+}
+
+// notifyStatus asks the reporter to send a printer_status if anything changed.
+func (a *printAgent) notifyStatus() {
+	select {
+	case a.statusChanged <- struct{}{}:
+	default:
+	}
+}
+
+// resetStatus forgets the last report, so the next one is always sent
+// (used after registering, the server may have lost track of us).
+func (a *printAgent) resetStatus() {
+	a.statusMu.Lock()
+	a.lastStatus = nil
+	a.statusMu.Unlock()
+	a.notifyStatus()
+}
+
+// runStatusReporter probes the printer on a schedule and reports its health.
+func (a *printAgent) runStatusReporter(ctx context.Context) {
+	ticker := time.NewTicker(a.statusInterval())
+	defer ticker.Stop()
+
+	a.probe(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.probe(ctx)
+			a.reportStatus(true)
+		case <-a.statusChanged:
+			a.reportStatus(false)
+		}
+	}
+}
+
+// probe checks the printer unless a job is printing: most printers accept a
+// single connection, and the job updates the observed status anyway.
+func (a *printAgent) probe(ctx context.Context) {
+	p := a.printer
+	if p.IP == "" || p.Port == 0 {
+		return
+	}
+	if !a.printMu.TryLock() {
+		return
+	}
+	defer a.printMu.Unlock()
+
+	dialer := net.Dialer{Timeout: statusProbeTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(p.IP, strconv.Itoa(p.Port)))
+	if err != nil {
+		if ctx.Err() == nil {
+			observePrinter(p.AgentKey, false, nil)
+		}
+		return
+	}
+	defer conn.Close()
+
+	// Only ESC/POS printers understand DLE EOT
+	if !isThermal(p) {
+		observePrinter(p.AgentKey, true, nil)
+		return
+	}
+	state, known := newStatusReader(conn).Poll()
+	observePrinter(p.AgentKey, true, observedState(state, known))
+}
+
+// printerStatus builds the current health report.
+func (a *printAgent) printerStatus() model.WSMessageTypePrinterStatus {
+	msg := model.WSMessageTypePrinterStatus{
+		Type:          model.MessageTypePrinterStatus,
+		AgentKey:      a.printer.AgentKey,
+		PrinterStatus: model.PrinterStatusOnline,
+		QueueDepth:    a.queue.Pending(),
+		Paused:        a.Paused(),
+		AgentVersion:  a.version,
+		Timestamp:     time.Now().Unix(),
+	}
+
+	if obs, ok := lastObservation(a.printer.AgentKey); ok {
+		msg.Reachable = obs.Reachable
+		msg.State = obs.State
+		switch {
+		case !obs.Reachable:
+			msg.PrinterStatus = model.PrinterStatusUnreachable
+		case obs.State != nil:
+			msg.PrinterStatus = obs.State.Status()
+		}
+	}
+
+	a.statusMu.Lock()
+	if !a.lastPrintedAt.IsZero() {
+		printedAt := a.lastPrintedAt
+		msg.LastPrintedAt = &printedAt
+	}
+	a.statusMu.Unlock()
+	return msg
+}
+
+// reportStatus sends the health report; unless force is set it is only sent
+// when it differs from the previous one.
+func (a *printAgent) reportStatus(force bool) {
+	msg := a.printerStatus()
+
+	a.statusMu.Lock()
+	changed := a.lastStatus == nil || !sameStatus(*a.lastStatus, msg)
+	a.statusMu.Unlock()
+	if !force && !changed {
+		return
+	}
+
+	if err := a.post(msg); err != nil {
+		return
+	}
+	if changed {
+		log.Printf("[%s] Printer status: %s (queue: %d)", a.printer.Name, msg.PrinterStatus, msg.QueueDepth)
+	}
+
+	a.statusMu.Lock()
+	a.lastStatus = &msg
+	a.statusMu.Unlock()
+}
+
+func (a *printAgent) setLastPrinted(t time.Time) {
+	a.statusMu.Lock()
+	a.lastPrintedAt = t
+	a.statusMu.Unlock()
+}
+
+// sameStatus compares two reports ignoring the timestamp.
+func sameStatus(x, y model.WSMessageTypePrinterStatus) bool {
+	if x.Reachable != y.Reachable || x.PrinterStatus != y.PrinterStatus || x.QueueDepth != y.QueueDepth || x.Paused != y.Paused {
+		return false
+	}
+	if (x.State == nil) != (y.State == nil) || (x.State != nil && *x.State != *y.State) {
+		return false
+	}
+	if (x.LastPrintedAt == nil) != (y.LastPrintedAt == nil) || (x.LastPrintedAt != nil && !x.LastPrintedAt.Equal(*y.LastPrintedAt)) {
+		return false
+	}
+	return true
+}
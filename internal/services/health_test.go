@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+// fakeNetworkPrinter listens on localhost and answers DLE EOT n with replies[n].
+func fakeNetworkPrinter(t *testing.T, replies map[byte]byte) (string, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req := make([]byte, 3)
+				for {
+					if _, err := conn.Read(req); err != nil {
+						return
+					}
+					if b, ok := replies[req[2]]; ok {
+						conn.Write([]byte{b})
+					}
+				}
+			}()
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func TestProbeQueriesThermalStatus(t *testing.T) {
+	ip, port := fakeNetworkPrinter(t, map[byte]byte{
+		statusPrinter: 0x1A, statusOffline: 0x12, statusError: 0x12, statusPaperRoll: 0x12,
+	})
+
+	tests := []struct {
+		printerType string
+		wantState   bool
+	}{
+		{"thermal", true},
+		{"", true}, // no type means thermal
+		{" Thermal ", true},
+		{"laser", false},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Quote(tt.printerType), func(t *testing.T) {
+			a := newTestAgent(t, model.Printer{Name: "Kitchen", AgentKey: "probe-" + tt.printerType, IP: ip, Port: port, Type: tt.printerType})
+			a.probe(context.Background())
+
+			obs, ok := lastObservation(a.printer.AgentKey)
+			if !ok || !obs.Reachable {
+				t.Fatalf("observation = %+v, %v; want reachable", obs, ok)
+			}
+			if got := obs.State != nil; got != tt.wantState {
+				t.Fatalf("status queried = %v, want %v", got, tt.wantState)
+			}
+			if tt.wantState && !obs.State.Offline {
+				t.Fatalf("state = %+v, want offline", *obs.State)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+const defaultDedupeRetention = 24 * time.Hour
+
+// Duplicate handling policies
+const (
+	DuplicatePolicySkip = "skip" // acknowledge without printing (default)
+	DuplicatePolicyFlag = "flag" // print again with a DUPLICATE banner
+)
+
+// --- Print History (duplicate detection) ---
+
+// PrintHistory remembers the orders printed recently on one printer, so a
+// print_order redelivered after a reconnect does not produce a second ticket.
+type PrintHistory struct {
+	mu        sync.Mutex
+	path      string
+	retention time.Duration
+	records   []model.PrintRecord
+}
+
+// OpenPrintHistory loads the history file of a printer stored next to its queue.
+func OpenPrintHistory(dir string, agentKey string, retention time.Duration) (*PrintHistory, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %v", err)
+	}
+	if retention <= 0 {
+		retention = defaultDedupeRetention
+	}
+
+	h := &PrintHistory{
+		path:      filepath.Join(dir, agentKey+".history.json"),
+		retention: retention,
+	}
+
+	data, err := os.ReadFile(h.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read history file: %v", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &h.records); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal history file %s: %v", h.path, err)
+		}
+	}
+	return h, nil
+}
+
+// Seen returns the previous record of the same print request, if any.
+func (h *PrintHistory) Seen(rec model.PrintRecord) (model.PrintRecord, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.prune(time.Now())
+	key := rec.Key()
+	for _, r := range h.records {
+		if r.Key() == key {
+			return r, true
+		}
+	}
+	return model.PrintRecord{}, false
+}
+
+// Record stores a printed request and drops records older than the retention window.
+func (h *PrintHistory) Record(rec model.PrintRecord) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if rec.PrintedAt.IsZero() {
+		rec.PrintedAt = time.Now()
+	}
+	h.prune(rec.PrintedAt)
+	h.records = append(h.records, rec)
+	return h.save()
+}
+
+// LastPrintedAt returns when the most recent record was printed.
+func (h *PrintHistory) LastPrintedAt() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var last time.Time
+	for _, r := range h.records {
+		if r.PrintedAt.After(last) {
+			last = r.PrintedAt
+		}
+	}
+	return last
+}
+
+// prune removes expired records. Caller must hold h.mu.
+func (h *PrintHistory) prune(now time.Time) {
+	kept := h.records[:0]
+	for _, r := range h.records {
+		if now.Sub(r.PrintedAt) < h.retention {
+			kept = append(kept, r)
+		}
+	}
+	h.records = kept
+}
+
+// save writes the history to disk. Caller must hold h.mu.
+func (h *PrintHistory) save() error {
+	data, err := json.MarshalIndent(h.records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := h.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write history file: %v", err)
+	}
+	return os.Rename(tmpPath, h.path)
+}
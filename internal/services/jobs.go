@@ -0,0 +1,464 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+const (
+	defaultJobMaxAttempts  = 20
+	jobRetryBaseDelay      = 2 * time.Second
+	jobRetryMaxDelay       = 60 * time.Second
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+var (
+	errNotConnected = errors.New("not connected to server")
+	errPreempted    = errors.New("preempted by a higher priority job")
+)
+
+// permanentError marks failures that retrying cannot fix (bad template, bad HTML...)
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// --- Print Agent ---
+
+// printAgent holds the state shared by the WebSocket connection and the
+// print worker of a single printer. It outlives reconnections.
+type printAgent struct {
+	printer model.Printer
+	config  model.Config
+	queue   *JobQueue
+	history *PrintHistory
+
+	writerMu sync.Mutex
+	writer   *wsWriter
+
+	reportMu sync.Mutex
+	printMu  sync.Mutex // held while a job talks to the printer
+	queueDir string
+	paused   atomic.Bool // jobs are held in the queue while set
+	retiring atomic.Bool // removed from the configuration: hand pending jobs over on stop
+
+	version       string
+	statusMu      sync.Mutex
+	lastStatus    *model.WSMessageTypePrinterStatus
+	lastPrintedAt time.Time
+	statusChanged chan struct{}
+
+	workerDone chan struct{} // closed when the print worker has exited
+}
+
+func (a *printAgent) setWriter(w *wsWriter) {
+	a.writerMu.Lock()
+	a.writer = w
+	a.writerMu.Unlock()
+}
+
+func (a *printAgent) currentWriter() *wsWriter {
+	a.writerMu.Lock()
+	defer a.writerMu.Unlock()
+	return a.writer
+}
+
+// send writes a JSON message to the server and waits for the result.
+func (a *printAgent) send(msg interface{}) error {
+	w := a.currentWriter()
+	if w == nil {
+		return errNotConnected
+	}
+	return w.Send(msg)
+}
+
+// post queues a JSON message for the server without waiting.
+func (a *printAgent) post(msg interface{}) error {
+	w := a.currentWriter()
+	if w == nil {
+		return errNotConnected
+	}
+	return w.Post(msg)
+}
+
+func (a *printAgent) shutdownTimeout() time.Duration {
+	if a.config.ShutdownTimeoutSeconds > 0 {
+		return time.Duration(a.config.ShutdownTimeoutSeconds) * time.Second
+	}
+	return defaultShutdownTimeout
+}
+
+func (a *printAgent) maxAttempts() int {
+	if a.config.JobMaxAttempts > 0 {
+		return a.config.JobMaxAttempts
+	}
+	return defaultJobMaxAttempts
+}
+
+// retryDelay doubles the wait after every failed attempt, up to jobRetryMaxDelay.
+func retryDelay(attempts int) time.Duration {
+	delay := jobRetryBaseDelay
+	for i := 1; i < attempts && delay < jobRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > jobRetryMaxDelay {
+		delay = jobRetryMaxDelay
+	}
+	return delay
+}
+
+// --- Print Worker ---
+
+// runWorker prints queued jobs one at a time until ctx is cancelled.
+// A job already printing when ctx is cancelled may finish within the
+// shutdown timeout; after that it is aborted and resumed on next start.
+func (a *printAgent) runWorker(ctx context.Context) {
+	p := a.printer
+	defer close(a.workerDone)
+
+	if pending := a.queue.Pending(); pending > 0 {
+		log.Printf("[%s] Resuming %d queued job(s)", p.Name, pending)
+	}
+
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-jobCtx.Done():
+			return
+		}
+		select {
+		case <-time.After(a.shutdownTimeout()):
+			log.Printf("[%s] Shutdown timeout reached, aborting current job.", p.Name)
+			cancelJobs()
+		case <-jobCtx.Done():
+		}
+	}()
+
+	defer func() {
+		if a.retiring.Load() {
+			a.handOffPending()
+		}
+		if err := a.queue.Flush(); err != nil {
+			log.Printf("[%s] Warning: Failed to save job queue: %v", p.Name, err)
+		}
+	}()
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Paused: hold every job until resumed (the resume wakes the queue)
+		if a.Paused() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-a.queue.Wake():
+			}
+			continue
+		}
+
+		job, wait := a.queue.NextReady(time.Now())
+		if job != nil {
+			a.processJob(jobCtx, job)
+			continue
+		}
+
+		var retry <-chan time.Time
+		if wait > 0 {
+			retry = time.After(wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.queue.Wake():
+		case <-retry:
+		}
+	}
+}
+
+func (a *printAgent) processJob(ctx context.Context, job *model.PrintJob) {
+	p := a.printer
+	log.Printf("[%s] Processing Order ID: %d (attempt %d, Type: %s)", p.Name, job.OrderID, job.Attempts+1, p.Type)
+
+	a.printMu.Lock()
+	err := a.printJob(ctx, job)
+	a.printMu.Unlock()
+	defer a.notifyStatus()
+
+	if err == nil {
+		a.queue.Update(job, func(j *model.PrintJob) {
+			j.Attempts++
+			j.Status = model.JobStatusPrinted
+			j.LastError = ""
+			j.FinishedAt = time.Now()
+		})
+		log.Printf("[%s] Order %d sent successfully!", p.Name, job.OrderID)
+		a.setLastPrinted(job.FinishedAt)
+		a.remember(job)
+		a.report(job)
+		return
+	}
+
+	// A more urgent job arrived between copies: resume the remaining copies after it
+	if errors.Is(err, errPreempted) {
+		a.queue.Update(job, func(j *model.PrintJob) { j.NextAttemptAt = time.Now() })
+		log.Printf("[%s] Order %d paused after %d of %d copies for a higher priority job.",
+			p.Name, job.OrderID, job.CopiesPrinted, job.Copies())
+		return
+	}
+
+	// Interrupted by shutdown: keep the job pending, it resumes on next start
+	if ctx.Err() != nil {
+		a.queue.Update(job, func(j *model.PrintJob) { j.LastError = err.Error() })
+		log.Printf("[%s] Order %d interrupted by shutdown, will resume on restart.", p.Name, job.OrderID)
+		return
+	}
+
+	var permErr permanentError
+	isPermanent := errors.As(err, &permErr)
+
+	a.queue.Update(job, func(j *model.PrintJob) {
+		j.Attempts++
+		j.LastError = err.Error()
+	})
+
+	// A bad ticket would fail on the backup printer too
+	if !isPermanent && (job.Attempts >= a.maxAttempts() || needsAttention(err)) && a.reroute(job, err) {
+		return
+	}
+
+	a.queue.Update(job, func(j *model.PrintJob) {
+		if isPermanent || j.Attempts >= a.maxAttempts() {
+			j.Status = model.JobStatusFailed
+			j.FinishedAt = time.Now()
+		} else {
+			j.NextAttemptAt = time.Now().Add(retryDelay(j.Attempts))
+		}
+	})
+
+	if job.Status == model.JobStatusFailed {
+		log.Printf("[%s] Order %d failed after %d attempt(s): %v", p.Name, job.OrderID, job.Attempts, err)
+		a.report(job)
+		return
+	}
+	log.Printf("[%s] Order %d attempt %d failed: %v. Retrying in %s...",
+		p.Name, job.OrderID, job.Attempts, err, time.Until(job.NextAttemptAt).Round(time.Second))
+}
+
+// printJob renders the ticket and sends the copies not printed yet.
+func (a *printAgent) printJob(ctx context.Context, job *model.PrintJob) error {
+	p := a.printer
+	data := job.Data
+	renderStart := time.Now()
+
+	// Structured orders are rendered locally with our own layout
+	if data.Content == "" && data.Order != nil {
+		content, err := renderOrderTemplate(ctx, p, data)
+		if err != nil {
+			return permanent(err)
+		}
+		data.Content = content
+	}
+
+	// Ensure we have content to print
+	if data.Content == "" {
+		return permanent(fmt.Errorf("received empty content"))
+	}
+
+	if job.Duplicate {
+		data.Content = addBanner(data.Content, "DUPLICATE")
+	}
+	if job.ReroutedFrom != "" {
+		data.Content = addBanner(data.Content, "REROUTED from "+job.ReroutedFrom)
+	}
+
+	// Ensure tmp directory exists
+	tmpDir := "tmp"
+	if _, err := os.Stat(tmpDir); os.IsNotExist(err) {
+		os.Mkdir(tmpDir, 0755)
+	}
+
+	// 1. Render the ticket
+	var printCopy func() (int, error)
+	if usesTextRenderer(p) {
+		escposData, err := renderHTMLToESCPOS(data.Content, p)
+		if err != nil {
+			return permanent(fmt.Errorf("failed to render text ticket: %w", err))
+		}
+		log.Printf("[%s] Text ticket rendered (%d bytes)", p.Name, len(escposData))
+		printCopy = func() (int, error) { return writeToPrinter(ctx, p, escposData) }
+	} else {
+		fileName := fmt.Sprintf("%s_order_%d_%d.png", p.AgentKey, job.OrderID, time.Now().Unix())
+		imgPath := filepath.Join(tmpDir, fileName)
+
+		if err := generateOrderImage(ctx, data.Content, imgPath); err != nil {
+			return err
+		}
+		log.Printf("[%s] IMG generated: %s", p.Name, imgPath)
+
+		// Cleanup once all copies are sent (or the attempt failed)
+		defer func() {
+			if err := os.Remove(imgPath); err != nil {
+				log.Printf("[%s] Warning: Failed to delete tmp file: %v", p.Name, err)
+			} else {
+				log.Printf("[%s] Tmp file deleted.", p.Name)
+			}
+		}()
+		printCopy = func() (int, error) { return sendFileToPrinter(ctx, p, imgPath) }
+	}
+	renderTime := time.Since(renderStart)
+	a.queue.Update(job, func(j *model.PrintJob) { j.RenderTime += renderTime })
+
+	// 2. Send to Printer (Loop for the copies still missing)
+	copies := job.Copies()
+	for job.CopiesPrinted < copies {
+		log.Printf("[%s] Printing copy %d of %d", p.Name, job.CopiesPrinted+1, copies)
+		printStart := time.Now()
+		n, err := printCopy()
+		printTime := time.Since(printStart)
+
+		a.queue.Update(job, func(j *model.PrintJob) {
+			j.BytesSent += n
+			j.PrintTime += printTime
+			j.PrinterStatus = printerStatusOf(err)
+			if err == nil {
+				j.CopiesPrinted++
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send to printer: %w", err)
+		}
+		if job.CopiesPrinted < copies && a.queue.Preempts(job, time.Now()) {
+			return errPreempted
+		}
+	}
+	return nil
+}
+
+// --- Duplicate Detection ---
+
+func (a *printAgent) duplicatePolicy() string {
+	if strings.ToLower(strings.TrimSpace(a.config.DuplicatePolicy)) == DuplicatePolicyFlag {
+		return DuplicatePolicyFlag
+	}
+	return DuplicatePolicySkip
+}
+
+// queuedRequest returns the job of the same request if it is still in the
+// queue (waiting, retrying or not reported yet). Orders without an id are
+// never deduplicated.
+func (a *printAgent) queuedRequest(data model.PrinterData) *model.PrintJob {
+	rec := model.RecordFor(data)
+	if rec.OrderID == 0 {
+		return nil
+	}
+	return a.queue.FindRequest(rec)
+}
+
+// alreadyPrinted reports whether the request was printed recently.
+func (a *printAgent) alreadyPrinted(data model.PrinterData) bool {
+	rec := model.RecordFor(data)
+	if rec.OrderID == 0 {
+		return false
+	}
+	if prev, seen := a.history.Seen(rec); seen {
+		log.Printf("[%s] Order %d already printed at %s", a.printer.Name, rec.OrderID, prev.PrintedAt.Format(time.RFC3339))
+		return true
+	}
+	return false
+}
+
+// remember adds a printed job to the history used for duplicate detection.
+func (a *printAgent) remember(job *model.PrintJob) {
+	if job.OrderID == 0 {
+		return
+	}
+	if err := a.history.Record(model.RecordFor(job.Data)); err != nil {
+		log.Printf("[%s] Warning: Failed to update print history: %v", a.printer.Name, err)
+	}
+}
+
+// --- Reporting ---
+
+// report tells the server about a finished job and drops it from the queue.
+// If the socket is down the job stays queued and is reported after reconnecting.
+func (a *printAgent) report(job *model.PrintJob) {
+	p := a.printer
+
+	// The worker and a reconnect flush may race to report the same job
+	a.reportMu.Lock()
+	defer a.reportMu.Unlock()
+	if !a.queue.Has(job.ID) {
+		return
+	}
+
+	var msg interface{}
+	switch job.Status {
+	case model.JobStatusPrinted:
+		msg = model.WSMessageTypePrinted{
+			Type:      model.MessageTypePrinted,
+			AgentKey:  p.AgentKey,
+			OrderID:   job.OrderID,
+			JobReport: job.Report(),
+		}
+	case model.JobStatusRouted:
+		msg = model.WSMessageTypeRouted{
+			Type:     model.MessageTypeRouted,
+			AgentKey: p.AgentKey,
+			OrderID:  job.OrderID,
+			Routes:   job.Routes,
+		}
+	case model.JobStatusRerouted:
+		msg = model.WSMessageTypeRerouted{
+			Type:             model.MessageTypeRerouted,
+			AgentKey:         p.AgentKey,
+			OrderID:          job.OrderID,
+			FallbackAgentKey: job.ReroutedTo,
+			Reason:           job.LastError,
+			JobReport:        job.Report(),
+		}
+	default:
+		msg = model.WSMessageTypePrintFailed{
+			Type:      model.MessageTypePrintFailed,
+			AgentKey:  p.AgentKey,
+			OrderID:   job.OrderID,
+			Error:     job.LastError,
+			JobReport: job.Report(),
+		}
+	}
+
+	if err := a.send(msg); err != nil {
+		log.Printf("[%s] Could not report order %d (%s), will retry after reconnect: %v", p.Name, job.OrderID, job.Status, err)
+		return
+	}
+	if err := a.queue.Remove(job.ID); err != nil {
+		log.Printf("[%s] Warning: Failed to update job queue: %v", p.Name, err)
+	}
+}
+
+// flushReports sends every result that could not be delivered earlier.
+func (a *printAgent) flushReports() {
+	for _, job := range a.queue.Unreported() {
+		a.report(job)
+	}
+}
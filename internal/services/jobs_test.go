@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+func newTestAgent(t *testing.T, p model.Printer) *printAgent {
+	t.Helper()
+	dir := t.TempDir()
+	queue, err := OpenJobQueue(dir, p.AgentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := OpenPrintHistory(dir, p.AgentKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &printAgent{
+		printer:       p,
+		queue:         queue,
+		history:       history,
+		queueDir:      dir,
+		statusChanged: make(chan struct{}, 1),
+		workerDone:    make(chan struct{}),
+	}
+}
+
+func TestRedeliveredOrderWaitsForQueuedJob(t *testing.T) {
+	a := newTestAgent(t, model.Printer{Name: "Kitchen", AgentKey: "k1"})
+	data := model.PrinterData{Content: "<p>1</p>", Metadata: model.Metadata{OrderId: 7, Timestamp: "t1"}}
+
+	first := a.enqueueOrder(context.Background(), data)
+	again := a.enqueueOrder(context.Background(), data)
+
+	if again.ID != first.ID || again.Status != model.JobStatusPending {
+		t.Fatalf("redelivery = %s (%s), want the queued job %s", again.ID, again.Status, first.ID)
+	}
+	if jobs := a.queue.Snapshot(); len(jobs) != 1 || jobs[0].Status != model.JobStatusPending {
+		t.Fatalf("queue = %+v, want only the original pending job", jobs)
+	}
+}
+
+func TestRedeliveredPrintedOrderIsSkipped(t *testing.T) {
+	a := newTestAgent(t, model.Printer{Name: "Kitchen", AgentKey: "k1"})
+	data := model.PrinterData{Content: "<p>1</p>", Metadata: model.Metadata{OrderId: 7, Timestamp: "t1"}}
+	if err := a.history.Record(model.RecordFor(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	job := a.enqueueOrder(context.Background(), data)
+	if !job.Duplicate || job.Status != model.JobStatusPrinted || job.CopiesPrinted != 0 {
+		t.Fatalf("job = %+v, want a skipped duplicate", job)
+	}
+}
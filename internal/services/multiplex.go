@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+const multiplexRegisterTimeout = 10 * time.Second
+
+var errMultiplexUnsupported = errors.New("server does not support multiplexed connections")
+
+// --- Multiplexed Connection ---
+
+// runMultiplexed keeps a single WebSocket registered for every agent key and
+// routes messages to the right printer. It only returns when the server
+// turns out not to support multiplexing.
+func runMultiplexed(ctx context.Context, agents []*printAgent, config model.Config) error {
+	byKey := make(map[string]*printAgent, len(agents))
+	for _, agent := range agents {
+		byKey[agent.printer.AgentKey] = agent
+	}
+
+	log.Printf("[mux] Connecting to WebSocket for %d printers...", len(agents))
+	bo := newBackoff()
+	defer setStates(agents, model.ConnStateDisconnected)
+
+	for ctx.Err() == nil {
+		setStates(agents, model.ConnStateConnecting)
+		conn, err := dialServer(ctx, config)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			wait := bo.Next()
+			setStates(agents, model.ConnStateBackingOff)
+			log.Printf("[mux] Connection failed: %v. Retrying in %s...", err, wait.Round(time.Millisecond))
+			sleepContext(ctx, wait)
+			continue
+		}
+
+		log.Printf("[mux] Connected.")
+		err = handleMultiplexedConnection(ctx, conn, byKey, bo)
+		conn.Close()
+
+		if errors.Is(err, errMultiplexUnsupported) {
+			return err
+		}
+		if ctx.Err() != nil {
+			log.Printf("[mux] Disconnected.")
+			return nil
+		}
+		wait := bo.Next()
+		setStates(agents, model.ConnStateBackingOff)
+		log.Printf("[mux] Disconnected. Reconnecting in %s...", wait.Round(time.Millisecond))
+		sleepContext(ctx, wait)
+	}
+	return nil
+}
+
+func setStates(agents []*printAgent, state model.ConnectionState) {
+	for _, agent := range agents {
+		agent.setState(state)
+	}
+}
+
+func handleMultiplexedConnection(ctx context.Context, conn *websocket.Conn, byKey map[string]*printAgent, bo *backoff) error {
+	var hb heartbeat
+	for _, agent := range byKey {
+		hb = heartbeatFor(agent.config)
+		break
+	}
+	writer := newWSWriter(conn, hb)
+	for _, agent := range byKey {
+		agent.setWriter(writer)
+	}
+	defer func() {
+		for _, agent := range byKey {
+			agent.setWriter(nil)
+		}
+		writer.Close()
+	}()
+
+	agents := make([]*printAgent, 0, len(byKey))
+	for _, agent := range byKey {
+		agents = append(agents, agent)
+	}
+	connDone := make(chan struct{})
+	defer close(connDone)
+	go closeOnShutdown(ctx, conn, writer, agents, connDone)
+
+	keys := make([]string, 0, len(byKey))
+	for key, agent := range byKey {
+		keys = append(keys, key)
+		agent.setState(model.ConnStateRegistering)
+	}
+
+	regMsg := model.WSMessage{
+		Type:      model.MessageTypeRegister,
+		AgentKeys: keys,
+	}
+	if err := writer.Send(regMsg); err != nil {
+		log.Printf("[mux] Failed to send register: %v", err)
+		return err
+	}
+
+	// A server that supports multiplexing answers with the registered keys.
+	// Anything else (error, timeout, single-key reply) means it does not.
+	registered := false
+	conn.SetReadDeadline(time.Now().Add(multiplexRegisterTimeout))
+
+	for {
+		var msg model.WSMessage
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if registered {
+				logReadError("mux", err)
+			} else {
+				log.Printf("[mux] Read error: %v", err)
+			}
+			// No reply in time, or the server closed the socket on our register
+			var netErr net.Error
+			var closeErr *websocket.CloseError
+			if !registered && ((errors.As(err, &netErr) && netErr.Timeout()) || errors.As(err, &closeErr)) {
+				return errMultiplexUnsupported
+			}
+			return err
+		}
+		// Until registered, the register timeout applies
+		if registered {
+			hb.extendReadDeadline(conn)
+		}
+
+		switch msg.Type {
+		case model.MessageTypeRegistered:
+			if len(msg.AgentKeys) == 0 {
+				if !registered {
+					return errMultiplexUnsupported
+				}
+				continue
+			}
+			if !registered {
+				hb.watchConnection(conn)
+			}
+			registered = true
+			bo.Reset()
+
+			for _, key := range msg.AgentKeys {
+				agent, ok := byKey[key]
+				if !ok {
+					continue
+				}
+				log.Printf("[%s] Successfully registered with server (multiplexed).", agent.printer.Name)
+				agent.setState(model.ConnStateRegistered)
+				// Deliver results of jobs finished while we were offline
+				go agent.flushReports()
+				agent.resetStatus()
+			}
+			if len(msg.AgentKeys) < len(byKey) {
+				log.Printf("[mux] Warning: server registered %d of %d printers", len(msg.AgentKeys), len(byKey))
+			}
+
+		case model.MessageTypePing:
+			pongMsg := model.WSMessageTypePong{
+				Type:      model.MessageTypePong,
+				Timestamp: time.Now().Unix(),
+			}
+			writer.Post(pongMsg)
+
+		case model.MessageTypeNewOrder:
+			agent, ok := byKey[msg.AgentKey]
+			if !ok {
+				log.Printf("[mux] Received print order for unknown agent key %q", msg.AgentKey)
+				continue
+			}
+			log.Printf("[%s] Received print order...", agent.printer.Name)
+			handlePrintJob(ctx, agent, msg.Order)
+
+		case model.MessageTypePause, model.MessageTypeResume:
+			agent, ok := byKey[msg.AgentKey]
+			if !ok {
+				log.Printf("[mux] Received %s for unknown agent key %q", msg.Type, msg.AgentKey)
+				continue
+			}
+			handlePauseRequest(agent, msg.Type)
+
+		case model.MessageTypeUnregister:
+			if agent, ok := byKey[msg.AgentKey]; ok {
+				log.Printf("[%s] Server unregistered this printer.", agent.printer.Name)
+				agent.setWriter(nil)
+				agent.setState(model.ConnStateDisconnected)
+				continue
+			}
+			log.Printf("[mux] Server requested unregister.")
+			return nil
+
+		case model.MessageTypeError:
+			if !registered {
+				log.Printf("[mux] Server error during registration: %s", msg.Error)
+				return errMultiplexUnsupported
+			}
+			log.Printf("[mux] Server error: %s", msg.Error)
+
+		default:
+			if !registered && msg.Error != "" {
+				return errMultiplexUnsupported
+			}
+			log.Printf("[mux] Unknown message type: %s", msg.Type)
+		}
+	}
+}
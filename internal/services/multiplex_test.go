@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+// singleKeyServer is a WebSocket server without multiplexing: it answers a
+// register of several keys with an error and accepts one key per connection.
+type singleKeyServer struct {
+	mu          sync.Mutex
+	multiplexed int      // registers with several keys
+	perConnKeys []string // key registered on each connection
+	upgrader    websocket.Upgrader
+}
+
+func (s *singleKeyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var reg model.WSMessage
+	if err := conn.ReadJSON(&reg); err != nil || reg.Type != model.MessageTypeRegister {
+		return
+	}
+	s.mu.Lock()
+	if len(reg.AgentKeys) > 0 {
+		s.multiplexed++
+		s.mu.Unlock()
+		conn.WriteJSON(model.WSMessage{Type: model.MessageTypeError, Error: "agent_key is required"})
+	} else {
+		s.perConnKeys = append(s.perConnKeys, reg.AgentKey)
+		s.mu.Unlock()
+		conn.WriteJSON(model.WSMessage{Type: model.MessageTypeRegistered, AgentKey: reg.AgentKey})
+	}
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func TestMultiplexFallsBackToOneConnectionPerPrinter(t *testing.T) {
+	server := &singleKeyServer{}
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), model.ContextWSURL, "ws"+strings.TrimPrefix(srv.URL, "http")))
+	defer cancel()
+	var started []*runningAgent
+	for _, p := range []model.Printer{{Name: "Kitchen", AgentKey: "k1"}, {Name: "Bar", AgentKey: "k2"}} {
+		a := newTestAgent(t, p)
+		go a.runWorker(ctx)
+		started = append(started, &runningAgent{agent: a, ctx: ctx})
+	}
+	done := make(chan struct{})
+	go runMultiplexedAgents(ctx, started, model.Config{}, done)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, r := range started {
+		for ReadConnectionState(r.agent.queueDir, r.agent.printer.AgentKey) != model.ConnStateRegistered {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s never registered on its own connection", r.agent.printer.Name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("agents still connected after cancel")
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.multiplexed != 1 {
+		t.Errorf("multiplexed registers = %d, want 1", server.multiplexed)
+	}
+	keys := slices.Sorted(slices.Values(server.perConnKeys))
+	if !slices.Equal(keys, []string{"k1", "k2"}) {
+		t.Errorf("connections registered %v, want one for k1 and one for k2", keys)
+	}
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+const pausePollInterval = 2 * time.Second
+
+// --- Pause / Resume ---
+
+// A paused printer stays connected and keeps accepting orders, but holds them
+// in its queue until resumed. The state is a marker file next to the queue,
+// so it survives restarts and can be changed from the CLI while running.
+
+func pauseFile(dir string, agentKey string) string {
+	return filepath.Join(dir, agentKey+".paused")
+}
+
+// SetPaused pauses or resumes a printer. A running agent notices the change
+// within a few seconds.
+func SetPaused(dir string, agentKey string, paused bool) error {
+	path := pauseFile(dir, agentKey)
+	if !paused {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to resume printer: %v", err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create queue directory: %v", err)
+	}
+	stamp := []byte(time.Now().Format(time.RFC3339) + "\n")
+	if err := os.WriteFile(path, stamp, 0644); err != nil {
+		return fmt.Errorf("failed to pause printer: %v", err)
+	}
+	return nil
+}
+
+// IsPaused reports whether a printer is paused.
+func IsPaused(dir string, agentKey string) bool {
+	_, err := os.Stat(pauseFile(dir, agentKey))
+	return err == nil
+}
+
+func (a *printAgent) Paused() bool {
+	return a.paused.Load()
+}
+
+// setPaused persists the state and wakes the worker on resume.
+func (a *printAgent) setPaused(paused bool) error {
+	if err := SetPaused(a.queueDir, a.printer.AgentKey, paused); err != nil {
+		return err
+	}
+	a.applyPaused(paused)
+	return nil
+}
+
+func (a *printAgent) applyPaused(paused bool) {
+	if a.paused.Swap(paused) == paused {
+		return
+	}
+	if paused {
+		log.Printf("[%s] Printing paused, %d job(s) held in queue.", a.printer.Name, a.queue.Pending())
+	} else {
+		log.Printf("[%s] Printing resumed.", a.printer.Name)
+		a.queue.notify()
+	}
+	a.notifyStatus()
+}
+
+// handlePauseRequest applies a pause / resume message from the server.
+func handlePauseRequest(a *printAgent, msgType model.MessageType) {
+	if err := a.setPaused(msgType == model.MessageTypePause); err != nil {
+		log.Printf("[%s] %v", a.printer.Name, err)
+	}
+}
+
+// watchPaused picks up pause/resume requests made through the CLI.
+func (a *printAgent) watchPaused(ctx context.Context) {
+	ticker := time.NewTicker(pausePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.applyPaused(IsPaused(a.queueDir, a.printer.AgentKey))
+		}
+	}
+}
@@ -20,7 +20,10 @@ import (
 
 // --- Discovery Logic ---
 
-func DiscoverPrinters(config model.Config) []model.Printer {
+// DiscoverPrinters scans the local /24 subnet for raw printing ports. When
+// interactive, each printer is confirmed and named at the prompt; otherwise
+// every printer found is added with a default name.
+func DiscoverPrinters(config model.Config, interactive bool) []model.Printer {
 	localIP, err := utils.DetectLocalIP()
 	if err != nil {
 		log.Println("Error detecting IP:", err)
@@ -60,19 +63,27 @@ func DiscoverPrinters(config model.Config) []model.Printer {
 	reader := bufio.NewReader(os.Stdin)
 
 	for ip := range foundChan {
+		p := model.Printer{
+			IP:           ip,
+			Port:         9100,
+			IsEnabled:    true,
+			TenantID:     config.TenantID,
+			RestaurantID: config.RestaurantID,
+			Type:         model.PrinterTypeThermal,
+			Size:         utils.DefaultPrinterSize,
+		}
+
+		if !interactive {
+			p.Name = "Printer " + ip
+			p.Description = "Thermal Printer"
+			fmt.Printf("Found printer at %s, adding it as '%s'\n", ip, p.Name)
+			newPrinters = append(newPrinters, p)
+			continue
+		}
+
 		fmt.Printf("Found printer at %s. Add this printer? (y/n): ", ip)
 		ans, _ := reader.ReadString('\n')
 		if strings.TrimSpace(strings.ToLower(ans)) == "y" {
-			p := model.Printer{
-				IP:           ip,
-				Port:         9100,
-				IsEnabled:    true,
-				TenantID:     config.TenantID,
-				RestaurantID: config.RestaurantID,
-				Type:         model.PrinterTypeThermal,
-				Size:         576,
-			}
-
 			fmt.Print("  Name (e.g., Kitchen): ")
 			p.Name, _ = reader.ReadString('\n')
 			p.Name = strings.TrimSpace(p.Name)
@@ -152,31 +163,26 @@ func GetPrintersFromServer(ctx context.Context /*, p *model.Printer*/, apiKey st
 		return nil, fmt.Errorf("API Error %d: %s", resp.StatusCode, string(body))
 	}
 
-	var responseMap map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&responseMap); err != nil {
+	// A missing list must not read as "no printers": the sync would delete them all
+	var response struct {
+		Data struct {
+			Printers *[]json.RawMessage `json:"printers"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return nil, err
 	}
+	if response.Data.Printers == nil {
+		return nil, fmt.Errorf("no printers found in response")
+	}
 
-	if data, ok := responseMap["data"].(map[string]interface{}); ok {
-		if printers, ok := data["printers"].([]interface{}); ok {
-			var result []model.Printer
-			for _, item := range printers {
-				if pMap, ok := item.(map[string]interface{}); ok {
-					pBytes, err := json.Marshal(pMap)
-					if err != nil {
-						continue
-					}
-					var p model.Printer
-					if err := json.Unmarshal(pBytes, &p); err != nil {
-						continue
-					}
-					result = append(result, p)
-				}
-			}
-			return result, nil
+	result := make([]model.Printer, 0, len(*response.Data.Printers))
+	for i, item := range *response.Data.Printers {
+		var p model.Printer
+		if err := json.Unmarshal(item, &p); err != nil {
+			return nil, fmt.Errorf("failed to decode printer %d: %v", i, err)
 		}
-		return nil, nil
+		result = append(result, p)
 	}
-
-	return nil, fmt.Errorf("no agent_key found in response")
+	return result, nil
 }
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+// --- Persistent Job Queue ---
+
+// JobQueue is a per-printer list of print jobs stored as JSON on disk.
+// Every change is written atomically (tmp file + rename), so pending jobs
+// and unreported results survive a crash or restart of the agent.
+type JobQueue struct {
+	mu   sync.Mutex
+	path string
+	jobs []*model.PrintJob
+	wake chan struct{}
+}
+
+// OpenJobQueue loads (or creates) the queue file for a printer.
+func OpenJobQueue(dir string, agentKey string) (*JobQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %v", err)
+	}
+
+	q := &JobQueue{
+		path: filepath.Join(dir, agentKey+".json"),
+		wake: make(chan struct{}, 1),
+	}
+
+	data, err := os.ReadFile(q.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read queue file: %v", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &q.jobs); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal queue file %s: %v", q.path, err)
+		}
+	}
+	return q, nil
+}
+
+// RemovePrinterFiles deletes the history, pause and connection state files of
+// a removed printer, and its queue once no job is left in it. Reports the
+// server has not received yet stay queued and are sent if the printer is
+// added again.
+func RemovePrinterFiles(dir string, agentKey string) error {
+	queue, err := OpenJobQueue(dir, agentKey)
+	if err != nil {
+		return err
+	}
+	paths := []string{
+		filepath.Join(dir, agentKey+".history.json"),
+		pauseFile(dir, agentKey),
+		connStateFile(dir, agentKey),
+	}
+	if left := len(queue.Snapshot()); left > 0 {
+		log.Printf("Keeping the queue of %s: %d job(s) not reported to the server yet", agentKey, left)
+	} else {
+		paths = append(paths, queue.path)
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove printer files: %v", err)
+		}
+	}
+	return nil
+}
+
+// ErrAgentRunning is returned by LockQueueDir when another process owns the queues.
+var ErrAgentRunning = errors.New("another agent is already running")
+
+// AgentRunning reports whether an agent process currently owns the queues in dir.
+func AgentRunning(dir string) bool {
+	unlock, err := LockQueueDir(dir)
+	if err != nil {
+		return errors.Is(err, ErrAgentRunning)
+	}
+	unlock()
+	return false
+}
+
+// LockQueueDir makes sure a single agent process works on the queues in dir:
+// two processes would load the same pending jobs and print them twice. The
+// lock is released by unlock or when the process exits.
+func LockQueueDir(dir string) (unlock func(), err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %v", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "agent.lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue lock: %v", err)
+	}
+	if err := lockFile(f); err != nil {
+		if !lockHeld(err) {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock queue directory: %w", err)
+		}
+		pid, _ := io.ReadAll(f)
+		f.Close()
+		if pid := strings.TrimSpace(string(pid)); pid != "" {
+			return nil, fmt.Errorf("%w (pid %s)", ErrAgentRunning, pid)
+		}
+		return nil, ErrAgentRunning
+	}
+
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// Wake returns a channel signalled whenever a job is added or rescheduled.
+func (q *JobQueue) Wake() <-chan struct{} {
+	return q.wake
+}
+
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *JobQueue) Enqueue(job *model.PrintJob) error {
+	q.mu.Lock()
+	q.jobs = append(q.jobs, job)
+	err := q.save()
+	q.mu.Unlock()
+
+	q.notify()
+	return err
+}
+
+// Update applies fn to a queued job under the queue lock and persists the result.
+func (q *JobQueue) Update(job *model.PrintJob, fn func(job *model.PrintJob)) error {
+	q.mu.Lock()
+	fn(job)
+	err := q.save()
+	q.mu.Unlock()
+
+	q.notify()
+	return err
+}
+
+func (q *JobQueue) Remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, job := range q.jobs {
+		if job.ID == id {
+			q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+			return q.save()
+		}
+	}
+	return nil
+}
+
+// Has reports whether a job is still in the queue.
+func (q *JobQueue) Has(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, job := range q.jobs {
+		if job.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// FindRequest returns a copy of the queued job for the same print request, if any.
+func (q *JobQueue) FindRequest(rec model.PrintRecord) *model.PrintJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := rec.Key()
+	for _, job := range q.jobs {
+		if model.RecordFor(job.Data).Key() == key {
+			found := *job
+			return &found
+		}
+	}
+	return nil
+}
+
+// runsBefore reports whether job x should print before job y:
+// higher priority first, then arrival order.
+func runsBefore(x, y *model.PrintJob) bool {
+	if px, py := x.Data.PriorityLevel(), y.Data.PriorityLevel(); px != py {
+		return px > py
+	}
+	return x.CreatedAt.Before(y.CreatedAt)
+}
+
+// NextReady returns the pending job to print next among those whose retry
+// time has come. If none is ready it returns how long to wait for the next
+// one (0 = queue idle).
+func (q *JobQueue) NextReady(now time.Time) (*model.PrintJob, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var next *model.PrintJob
+	var wait time.Duration
+	for _, job := range q.jobs {
+		if job.Status != model.JobStatusPending {
+			continue
+		}
+		if !job.NextAttemptAt.After(now) {
+			if next == nil || runsBefore(job, next) {
+				next = job
+			}
+			continue
+		}
+		if d := job.NextAttemptAt.Sub(now); wait == 0 || d < wait {
+			wait = d
+		}
+	}
+	if next != nil {
+		return next, 0
+	}
+	return nil, wait
+}
+
+// Preempts reports whether a ready job with a higher priority than job is
+// waiting, so a multi-copy job should yield between copies.
+func (q *JobQueue) Preempts(job *model.PrintJob, now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	level := job.Data.PriorityLevel()
+	for _, other := range q.jobs {
+		if other == job || other.Status != model.JobStatusPending || other.NextAttemptAt.After(now) {
+			continue
+		}
+		if other.Data.PriorityLevel() > level {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot returns a copy of the queued jobs in print order: pending jobs by
+// priority and arrival, then finished jobs waiting to be reported.
+func (q *JobQueue) Snapshot() []model.PrintJob {
+	q.mu.Lock()
+	jobs := make([]*model.PrintJob, len(q.jobs))
+	copy(jobs, q.jobs)
+	sort.SliceStable(jobs, func(i, j int) bool {
+		x, y := jobs[i], jobs[j]
+		if x.IsTerminal() != y.IsTerminal() {
+			return !x.IsTerminal()
+		}
+		return runsBefore(x, y)
+	})
+
+	result := make([]model.PrintJob, len(jobs))
+	for i, job := range jobs {
+		result[i] = *job
+	}
+	q.mu.Unlock()
+	return result
+}
+
+// Unreported returns the finished jobs the server has not been told about yet.
+func (q *JobQueue) Unreported() []*model.PrintJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var result []*model.PrintJob
+	for _, job := range q.jobs {
+		if job.IsTerminal() {
+			result = append(result, job)
+		}
+	}
+	return result
+}
+
+// PendingJobs returns the jobs still waiting to be printed, in print order.
+func (q *JobQueue) PendingJobs() []*model.PrintJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var result []*model.PrintJob
+	for _, job := range q.jobs {
+		if job.Status == model.JobStatusPending {
+			result = append(result, job)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return runsBefore(result[i], result[j]) })
+	return result
+}
+
+// Pending returns how many jobs are still waiting to be printed.
+func (q *JobQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	count := 0
+	for _, job := range q.jobs {
+		if job.Status == model.JobStatusPending {
+			count++
+		}
+	}
+	return count
+}
+
+// Flush writes the current state to disk, used before exiting.
+func (q *JobQueue) Flush() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.save()
+}
+
+// save writes the queue to disk. Caller must hold q.mu.
+func (q *JobQueue) save() error {
+	data, err := json.MarshalIndent(q.jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := q.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write queue file: %v", err)
+	}
+	return os.Rename(tmpPath, q.path)
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package services
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on f without waiting for it.
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// lockHeld reports whether lockFile failed because another process holds the lock.
+func lockHeld(err error) bool {
+	return errors.Is(err, syscall.EWOULDBLOCK)
+}
+
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
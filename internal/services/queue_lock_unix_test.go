@@ -0,0 +1,26 @@
+//go:build unix
+
+package services
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestLockHeld(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{syscall.EWOULDBLOCK, true},
+		{fmt.Errorf("flock: %w", syscall.EWOULDBLOCK), true},
+		{syscall.ENOLCK, false},
+		{syscall.EBADF, false},
+	}
+	for _, tt := range tests {
+		if got := lockHeld(tt.err); got != tt.want {
+			t.Errorf("lockHeld(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
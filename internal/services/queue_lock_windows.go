@@ -0,0 +1,25 @@
+package services
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile takes an exclusive lock on f without waiting for it. The locked
+// byte is past the pid written to the file, so it stays readable.
+func lockFile(f *os.File) error {
+	overlapped := windows.Overlapped{Offset: 1 << 20}
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &overlapped)
+}
+
+// lockHeld reports whether lockFile failed because another process holds the lock.
+func lockHeld(err error) bool {
+	return errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
+
+func unlockFile(f *os.File) error {
+	overlapped := windows.Overlapped{Offset: 1 << 20}
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &overlapped)
+}
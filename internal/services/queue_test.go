@@ -0,0 +1,187 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+func TestLockQueueDirSingleAgent(t *testing.T) {
+	dir := t.TempDir()
+
+	unlock, err := LockQueueDir(dir)
+	if err != nil {
+		t.Fatalf("first lock: %v", err)
+	}
+	if _, err := LockQueueDir(dir); !errors.Is(err, ErrAgentRunning) {
+		t.Fatalf("second lock = %v, want ErrAgentRunning", err)
+	}
+
+	unlock()
+	unlock, err = LockQueueDir(dir)
+	if err != nil {
+		t.Fatalf("lock after unlock: %v", err)
+	}
+	unlock()
+}
+
+func TestRemovePrinterFiles(t *testing.T) {
+	dir := t.TempDir()
+	queues := make(map[string]*JobQueue)
+	for _, key := range []string{"k1", "k2"} {
+		q, err := OpenJobQueue(dir, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Enqueue(&model.PrintJob{ID: "j1", Status: model.JobStatusFailed}); err != nil {
+			t.Fatal(err)
+		}
+		queues[key] = q
+	}
+	if err := SetPaused(dir, "k1", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(connStateFile(dir, "k1"), []byte("online\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unreported job keeps the queue
+	if err := RemovePrinterFiles(dir, "k1"); err != nil {
+		t.Fatalf("RemovePrinterFiles = %v", err)
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "k1*")); len(left) != 1 || filepath.Base(left[0]) != "k1.json" {
+		t.Fatalf("files left = %v, want only k1.json", left)
+	}
+
+	// Once reported it goes; files already gone are not an error
+	if err := queues["k1"].Remove("j1"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := RemovePrinterFiles(dir, "k1"); err != nil {
+			t.Fatalf("RemovePrinterFiles = %v", err)
+		}
+	}
+	left, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(left) != 1 || filepath.Base(left[0]) != "k2.json" {
+		t.Fatalf("files left = %v, want only k2.json", left)
+	}
+}
+
+func newTestQueue(t *testing.T) *JobQueue {
+	t.Helper()
+	q, err := OpenJobQueue(t.TempDir(), "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestNextReadyOrder(t *testing.T) {
+	now := time.Now()
+	type queued struct {
+		id       string
+		priority string
+		age      time.Duration // before now
+		retryIn  time.Duration // NextAttemptAt after now
+		status   model.JobStatus
+	}
+	tests := []struct {
+		name     string
+		jobs     []queued
+		wantID   string
+		wantWait time.Duration
+	}{
+		{"empty queue", nil, "", 0},
+		{"oldest first", []queued{
+			{id: "new", age: time.Minute},
+			{id: "old", age: time.Hour},
+		}, "old", 0},
+		{"priority before age", []queued{
+			{id: "old", age: time.Hour},
+			{id: "rush", priority: model.PriorityRush, age: time.Minute},
+			{id: "high", priority: model.PriorityHigh, age: 2 * time.Minute},
+		}, "rush", 0},
+		{"low after normal", []queued{
+			{id: "low", priority: model.PriorityLow, age: time.Hour},
+			{id: "normal", priority: "unknown", age: time.Minute},
+		}, "normal", 0},
+		{"backoff skips higher priority", []queued{
+			{id: "rush", priority: model.PriorityRush, age: time.Hour, retryIn: time.Minute},
+			{id: "normal", age: time.Minute},
+		}, "normal", 0},
+		{"finished jobs ignored", []queued{
+			{id: "done", priority: model.PriorityRush, age: time.Hour, status: model.JobStatusPrinted},
+			{id: "normal", age: time.Minute},
+		}, "normal", 0},
+		{"waits for earliest retry", []queued{
+			{id: "later", age: time.Hour, retryIn: time.Minute},
+			{id: "sooner", age: time.Minute, retryIn: 10 * time.Second},
+		}, "", 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueue(t)
+			for _, j := range tt.jobs {
+				status := j.status
+				if status == "" {
+					status = model.JobStatusPending
+				}
+				job := &model.PrintJob{
+					ID:            j.id,
+					Data:          model.PrinterData{Priority: j.priority},
+					Status:        status,
+					CreatedAt:     now.Add(-j.age),
+					NextAttemptAt: now.Add(j.retryIn),
+				}
+				if err := q.Enqueue(job); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			next, wait := q.NextReady(now)
+			gotID := ""
+			if next != nil {
+				gotID = next.ID
+			}
+			if gotID != tt.wantID || wait != tt.wantWait {
+				t.Fatalf("NextReady = %q, %v; want %q, %v", gotID, wait, tt.wantID, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestPreempts(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		printing string
+		other    string
+		retryIn  time.Duration
+		want     bool
+	}{
+		{"higher priority waiting", model.PriorityNormal, model.PriorityRush, 0, true},
+		{"same priority", model.PriorityHigh, model.PriorityHigh, 0, false},
+		{"lower priority", model.PriorityHigh, model.PriorityLow, 0, false},
+		{"higher priority in backoff", model.PriorityNormal, model.PriorityRush, time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueue(t)
+			job := &model.PrintJob{ID: "printing", Data: model.PrinterData{Priority: tt.printing}, Status: model.JobStatusPending, CreatedAt: now.Add(-time.Hour)}
+			other := &model.PrintJob{ID: "other", Data: model.PrinterData{Priority: tt.other}, Status: model.JobStatusPending, CreatedAt: now, NextAttemptAt: now.Add(tt.retryIn)}
+			for _, j := range []*model.PrintJob{job, other} {
+				if err := q.Enqueue(j); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := q.Preempts(job, now); got != tt.want {
+				t.Fatalf("Preempts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
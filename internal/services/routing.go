@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+// Route keys matching every plate / drink line without a routed category
+const (
+	RouteCategoryPlates = "plates"
+	RouteCategoryDrinks = "drinks"
+)
+
+// --- Category Routing ---
+
+// ticketPart is the slice of an order printed by one station.
+type ticketPart struct {
+	agent      *printAgent
+	data       model.PrinterData
+	categories []string
+	items      int
+}
+
+// routeTarget returns the printer for the first category with a route,
+// or the receiving printer when none matches.
+func (a *printAgent) routeTarget(categories ...string) (*printAgent, string) {
+	for _, category := range categories {
+		category = strings.ToLower(strings.TrimSpace(category))
+		if category == "" {
+			continue
+		}
+		for key, ref := range a.config.Routes {
+			if strings.ToLower(strings.TrimSpace(key)) != category {
+				continue
+			}
+			if target := findAgent(ref); target != nil {
+				return target, category
+			}
+			log.Printf("[%s] Route %q points to unknown printer %q", a.printer.Name, category, ref)
+		}
+	}
+	return a, ""
+}
+
+// routeOrder splits an order according to the routing table. It returns nil
+// when the whole order stays on this printer.
+func (a *printAgent) routeOrder(data model.PrinterData) []*ticketPart {
+	if len(a.config.Routes) == 0 {
+		return nil
+	}
+
+	// Pre-rendered HTML cannot be split: route it as a whole by category
+	if data.Content != "" || data.Order == nil {
+		target, category := a.routeTarget(data.Metadata.Category)
+		if target == a {
+			return nil
+		}
+		return []*ticketPart{{agent: target, data: data, categories: []string{category}, items: 1}}
+	}
+
+	var parts []*ticketPart
+	partFor := func(target *printAgent, category string) *ticketPart {
+		var part *ticketPart
+		for _, existing := range parts {
+			if existing.agent == target {
+				part = existing
+			}
+		}
+		if part == nil {
+			order := *data.Order
+			order.Plates, order.Drinks, order.TotalAmount = nil, nil, 0
+			part = &ticketPart{agent: target, data: data}
+			part.data.Order = &order
+			parts = append(parts, part)
+		}
+		if category != "" && !containsString(part.categories, category) {
+			part.categories = append(part.categories, category)
+		}
+		part.items++
+		return part
+	}
+
+	for _, line := range data.Order.Plates {
+		part := partFor(a.routeTarget(line.Plate.Category, RouteCategoryPlates))
+		part.data.Order.Plates = append(part.data.Order.Plates, line)
+		part.data.Order.TotalAmount += line.Subtotal
+	}
+	for _, line := range data.Order.Drinks {
+		part := partFor(a.routeTarget(line.Drink.Category, RouteCategoryDrinks))
+		part.data.Order.Drinks = append(part.data.Order.Drinks, line)
+		part.data.Order.TotalAmount += line.Subtotal
+	}
+
+	if len(parts) == 0 || (len(parts) == 1 && parts[0].agent == a) {
+		return nil
+	}
+	return parts
+}
+
+// dispatchParts queues every part on its printer and sends the routing report.
+// The report is kept in the queue like a job result, so it is sent again
+// after a reconnect if the server cannot be reached now.
+func (a *printAgent) dispatchParts(ctx context.Context, orderID int, parts []*ticketPart) {
+	routes := make([]model.RouteReport, 0, len(parts))
+	for _, part := range parts {
+		target := part.agent.printer
+		log.Printf("[%s] Order %d: routing %d item(s) %v to %s", a.printer.Name, orderID, part.items, part.categories, target.Name)
+
+		job := part.agent.enqueueOrder(ctx, part.data)
+		routes = append(routes, model.RouteReport{
+			AgentKey:   target.AgentKey,
+			Printer:    target.Name,
+			JobID:      job.ID,
+			Categories: part.categories,
+			Items:      part.items,
+		})
+	}
+
+	now := time.Now()
+	routed := &model.PrintJob{
+		ID:         fmt.Sprintf("%d-%d", orderID, now.UnixNano()),
+		AgentKey:   a.printer.AgentKey,
+		OrderID:    orderID,
+		Status:     model.JobStatusRouted,
+		CreatedAt:  now,
+		FinishedAt: now,
+		Routes:     routes,
+	}
+	if err := a.queue.Enqueue(routed); err != nil {
+		log.Printf("[%s] Warning: Failed to persist routing report for order %d: %v", a.printer.Name, orderID, err)
+	}
+	go a.report(routed)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
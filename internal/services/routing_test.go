@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+func plate(name, category string, subtotal model.Money) model.OrderPlate {
+	return model.OrderPlate{Plate: model.Item{Name: name, Category: category}, Quantity: 1, Subtotal: subtotal}
+}
+
+func drink(name, category string, subtotal model.Money) model.OrderDrink {
+	return model.OrderDrink{Drink: model.Item{Name: name, Category: category}, Quantity: 1, Subtotal: subtotal}
+}
+
+func TestRouteOrder(t *testing.T) {
+	type wantPart struct {
+		plates, drinks int
+		total          model.Money
+	}
+	order := &model.Order{
+		ID:          7,
+		TotalAmount: 31,
+		Plates:      []model.OrderPlate{plate("Margherita", "Pizza", 9), plate("Carbonara", "Pasta", 12)},
+		Drinks:      []model.OrderDrink{drink("Spritz", "Cocktails", 7), drink("Water", "", 3)},
+	}
+	tests := []struct {
+		name   string
+		routes map[string]string
+		data   model.PrinterData
+		want   map[string]wantPart // by printer name; nil = not split
+	}{
+		{"no routes", nil, model.PrinterData{Order: order}, nil},
+		{"every route to the receiver", map[string]string{"plates": "Front", "drinks": "front"}, model.PrinterData{Order: order}, nil},
+		{"unknown printer stays here", map[string]string{"drinks": "Patio"}, model.PrinterData{Order: order}, nil},
+		{"empty order", map[string]string{"drinks": "Bar"}, model.PrinterData{Order: &model.Order{ID: 8}}, nil},
+		{"plates and drinks", map[string]string{"plates": "Kitchen", "drinks": "Bar"}, model.PrinterData{Order: order}, map[string]wantPart{
+			"Kitchen": {plates: 2, total: 21},
+			"Bar":     {drinks: 2, total: 10},
+		}},
+		{"category before catch-all", map[string]string{" PIZZA ": "Oven", "plates": "Kitchen"}, model.PrinterData{Order: order}, map[string]wantPart{
+			"Oven":    {plates: 1, total: 9},
+			"Kitchen": {plates: 1, total: 12},
+			"Front":   {drinks: 2, total: 10},
+		}},
+		{"unrouted lines stay here", map[string]string{"cocktails": "Bar"}, model.PrinterData{Order: order}, map[string]wantPart{
+			"Front": {plates: 2, drinks: 1, total: 24},
+			"Bar":   {drinks: 1, total: 7},
+		}},
+		{"drinks only", map[string]string{"drinks": "Bar"}, model.PrinterData{Order: &model.Order{Drinks: order.Drinks}}, map[string]wantPart{
+			"Bar": {drinks: 2, total: 10},
+		}},
+		{"pre-rendered by category", map[string]string{"pizza": "Oven"}, model.PrinterData{Content: "<p>7</p>", Metadata: model.Metadata{Category: "Pizza"}}, map[string]wantPart{
+			"Oven": {},
+		}},
+		{"pre-rendered without route", map[string]string{"pizza": "Oven"}, model.PrinterData{Content: "<p>7</p>", Metadata: model.Metadata{Category: "Pasta"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			front := newTestAgent(t, model.Printer{Name: "Front", AgentKey: "k1"})
+			front.config.Routes = tt.routes
+			runTestAgents(t,
+				front,
+				newTestAgent(t, model.Printer{Name: "Kitchen", AgentKey: "k2"}),
+				newTestAgent(t, model.Printer{Name: "Bar", AgentKey: "k3"}),
+				newTestAgent(t, model.Printer{Name: "Oven", AgentKey: "k4"}),
+			)
+
+			parts := front.routeOrder(tt.data)
+			if tt.want == nil {
+				if parts != nil {
+					t.Fatalf("got %d parts, want the order kept whole", len(parts))
+				}
+				return
+			}
+			if len(parts) != len(tt.want) {
+				t.Fatalf("got %d parts, want %d", len(parts), len(tt.want))
+			}
+			for _, part := range parts {
+				want, ok := tt.want[part.agent.printer.Name]
+				if !ok {
+					t.Fatalf("unexpected part for %s", part.agent.printer.Name)
+				}
+				if part.data.Content != "" {
+					continue
+				}
+				got := wantPart{len(part.data.Order.Plates), len(part.data.Order.Drinks), part.data.Order.TotalAmount}
+				if got != want {
+					t.Errorf("%s: got %+v, want %+v", part.agent.printer.Name, got, want)
+				}
+				if part.items != got.plates+got.drinks {
+					t.Errorf("%s: items = %d, want %d", part.agent.printer.Name, part.items, got.plates+got.drinks)
+				}
+			}
+			if order.TotalAmount != 31 || len(order.Plates) != 2 {
+				t.Fatal("routing modified the original order")
+			}
+		})
+	}
+}
+
+func TestRoutingReportIsResentAfterReconnect(t *testing.T) {
+	front := newTestAgent(t, model.Printer{Name: "Front", AgentKey: "k1"})
+	front.config.Routes = map[string]string{"plates": "Kitchen", "drinks": "Bar"}
+	kitchen := newTestAgent(t, model.Printer{Name: "Kitchen", AgentKey: "k2"})
+	bar := newTestAgent(t, model.Printer{Name: "Bar", AgentKey: "k3"})
+	runTestAgents(t, front, kitchen, bar)
+
+	data := model.PrinterData{Order: &model.Order{
+		ID:     7,
+		Plates: []model.OrderPlate{plate("Margherita", "Pizza", 9)},
+		Drinks: []model.OrderDrink{drink("Spritz", "Cocktails", 7)},
+	}, Metadata: model.Metadata{OrderId: 7}}
+
+	// Not connected: the report waits in the queue
+	front.dispatchParts(context.Background(), 7, front.routeOrder(data))
+	unreported := front.queue.Unreported()
+	if len(unreported) != 1 || unreported[0].Status != model.JobStatusRouted || len(unreported[0].Routes) != 2 {
+		t.Fatalf("queue = %+v, want the routing report", unreported)
+	}
+
+	received := make(chan []byte, 1)
+	w := newWSWriter(dialTestSocket(t, received), heartbeat{interval: time.Hour, timeout: time.Hour, writeTimeout: time.Second})
+	defer w.Close()
+	front.setWriter(w)
+	front.flushReports()
+
+	var msg model.WSMessageTypeRouted
+	select {
+	case raw := <-received:
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("routing report not sent after reconnect")
+	}
+	if msg.Type != model.MessageTypeRouted || msg.OrderID != 7 || len(msg.Routes) != 2 {
+		t.Fatalf("message = %+v, want the routing report of order 7", msg)
+	}
+	if len(front.queue.Unreported()) != 0 {
+		t.Fatal("routing report still queued after it was sent")
+	}
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+const (
+	statusQueryTimeout = 500 * time.Millisecond
+	statusSettleDelay  = 500 * time.Millisecond
+)
+
+// DLE EOT n real-time status requests
+const (
+	statusPrinter   byte = 1
+	statusOffline   byte = 2
+	statusError     byte = 3
+	statusPaperRoll byte = 4
+	asbEnableAll    byte = 0x0F // GS a: drawer, online/offline, error, paper sensor
+	asbDisable      byte = 0x00
+	asbFrameLength       = 4
+	statusFixedMask byte = 0x93 // bits that tell a DLE EOT reply from an ASB frame
+	statusReplyBits byte = 0x12
+	statusASBHeader byte = 0x10
+)
+
+// --- Printer Status (ESC/POS) ---
+
+// statusReader decodes the bytes a printer sends back on the job connection.
+// DLE EOT replies are single bytes; ASB frames are 4 bytes starting with a
+// header whose fixed bits differ, so both can share the same stream.
+type statusReader struct {
+	conn    net.Conn
+	replies chan byte
+	silent  bool // a query timed out: the printer does not answer DLE EOT
+
+	mu     sync.Mutex
+	asb    model.PrinterState
+	hasASB bool
+}
+
+func newStatusReader(conn net.Conn) *statusReader {
+	r := &statusReader{conn: conn, replies: make(chan byte, 8)}
+	go r.run()
+	return r
+}
+
+// run reads until the connection is closed.
+func (r *statusReader) run() {
+	buf := make([]byte, 64)
+	var frame []byte
+
+	for {
+		n, err := r.conn.Read(buf)
+		for _, b := range buf[:n] {
+			if len(frame) > 0 {
+				frame = append(frame, b)
+				if len(frame) == asbFrameLength {
+					r.setASB(decodeASB(frame))
+					frame = nil
+				}
+				continue
+			}
+			switch b & statusFixedMask {
+			case statusReplyBits:
+				select {
+				case r.replies <- b:
+				default:
+				}
+			case statusASBHeader:
+				frame = append(frame, b)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *statusReader) setASB(state model.PrinterState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Keep paper end sticky: the job must not be reported as printed if
+	// the paper ran out at any point while it was being sent.
+	state.PaperEnd = state.PaperEnd || r.asb.PaperEnd
+	r.asb = state
+	r.hasASB = true
+}
+
+// ASBState returns the state collected from automatic status back, if any.
+func (r *statusReader) ASBState() (model.PrinterState, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.asb, r.hasASB
+}
+
+// query sends DLE EOT n and waits briefly for the reply. After the first
+// timeout the printer is not asked again on this connection, so one that
+// ignores DLE EOT costs a single wait.
+func (r *statusReader) query(n byte) (byte, bool) {
+	if r.silent {
+		return 0, false
+	}
+	// Drop stale replies from an earlier query that timed out
+	for len(r.replies) > 0 {
+		<-r.replies
+	}
+	if _, err := r.conn.Write([]byte{0x10, 0x04, n}); err != nil {
+		return 0, false
+	}
+
+	timer := time.NewTimer(statusQueryTimeout)
+	defer timer.Stop()
+	select {
+	case b := <-r.replies:
+		return b, true
+	case <-timer.C:
+		r.silent = true
+		return 0, false
+	}
+}
+
+// Poll asks the printer for its real-time status. ok is false when the
+// printer does not answer DLE EOT (not every model supports it).
+func (r *statusReader) Poll() (state model.PrinterState, ok bool) {
+	b, ok := r.query(statusPrinter)
+	if !ok {
+		return state, false
+	}
+	state.Offline = b&0x08 != 0
+
+	if b, ok := r.query(statusOffline); ok {
+		state.CoverOpen = b&0x04 != 0
+		state.FeedButton = b&0x08 != 0
+		state.PaperEnd = b&0x20 != 0
+	}
+	if b, ok := r.query(statusError); ok {
+		state.MechanicalError = b&0x04 != 0
+		state.CutterError = b&0x08 != 0
+		state.UnrecoverableError = b&0x20 != 0
+		state.AutoRecoverableError = b&0x40 != 0
+	}
+	if b, ok := r.query(statusPaperRoll); ok {
+		state.PaperNearEnd = b&0x0C != 0
+		state.PaperEnd = state.PaperEnd || b&0x60 != 0
+	}
+	return state, true
+}
+
+// decodeASB decodes a 4-byte automatic status back frame.
+func decodeASB(frame []byte) model.PrinterState {
+	return model.PrinterState{
+		Offline:              frame[0]&0x08 != 0,
+		CoverOpen:            frame[0]&0x20 != 0,
+		FeedButton:           frame[0]&0x40 != 0,
+		MechanicalError:      frame[1]&0x04 != 0,
+		CutterError:          frame[1]&0x08 != 0,
+		UnrecoverableError:   frame[1]&0x20 != 0,
+		AutoRecoverableError: frame[1]&0x40 != 0,
+		PaperNearEnd:         frame[2]&0x03 != 0,
+		PaperEnd:             frame[2]&0x0C != 0,
+	}
+}
+
+// setStatusBack enables or disables automatic status back (GS a n).
+func setStatusBack(conn net.Conn, enable bool) error {
+	n := asbDisable
+	if enable {
+		n = asbEnableAll
+	}
+	_, err := conn.Write([]byte{0x1D, 0x61, n})
+	return err
+}
+
+// --- Last Observed Status ---
+
+// printerObservation is the latest status seen for a printer, either while
+// printing or by the periodic health probe.
+type printerObservation struct {
+	Reachable bool
+	State     *model.PrinterState // nil if the printer did not answer DLE EOT
+	CheckedAt time.Time
+}
+
+var (
+	observationsMu sync.RWMutex
+	observations   = make(map[string]printerObservation) // by agent key
+)
+
+func observePrinter(agentKey string, reachable bool, state *model.PrinterState) {
+	observationsMu.Lock()
+	defer observationsMu.Unlock()
+	observations[agentKey] = printerObservation{Reachable: reachable, State: state, CheckedAt: time.Now()}
+}
+
+func lastObservation(agentKey string) (printerObservation, bool) {
+	observationsMu.RLock()
+	defer observationsMu.RUnlock()
+	obs, ok := observations[agentKey]
+	return obs, ok
+}
+
+// observedState returns a pointer to the state when it is known.
+func observedState(state model.PrinterState, known bool) *model.PrinterState {
+	if !known {
+		return nil
+	}
+	return &state
+}
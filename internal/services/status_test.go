@@ -0,0 +1,172 @@
+package services
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+func TestDecodeASB(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+		want  model.PrinterState
+	}{
+		{"ready", []byte{0x10, 0x00, 0x00, 0x00}, model.PrinterState{}},
+		{"offline, cover open", []byte{0x38, 0x00, 0x00, 0x00}, model.PrinterState{Offline: true, CoverOpen: true}},
+		{"feed button", []byte{0x50, 0x00, 0x00, 0x00}, model.PrinterState{FeedButton: true}},
+		{"errors", []byte{0x10, 0x6C, 0x00, 0x00}, model.PrinterState{MechanicalError: true, CutterError: true, UnrecoverableError: true, AutoRecoverableError: true}},
+		{"paper near end", []byte{0x10, 0x00, 0x03, 0x00}, model.PrinterState{PaperNearEnd: true}},
+		{"paper end", []byte{0x10, 0x00, 0x0C, 0x00}, model.PrinterState{PaperEnd: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeASB(tt.frame); got != tt.want {
+				t.Fatalf("decodeASB(% x) = %+v, want %+v", tt.frame, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeStatusPrinter answers DLE EOT n with replies[n], sending asb first
+// when set. Requests without a reply are left unanswered.
+func fakeStatusPrinter(t *testing.T, replies map[byte]byte, asb []byte) *statusReader {
+	client, printer := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		printer.Close()
+	})
+
+	go func() {
+		req := make([]byte, 3)
+		for {
+			if _, err := printer.Read(req); err != nil {
+				return
+			}
+			if asb != nil {
+				printer.Write(asb)
+				asb = nil
+			}
+			if b, ok := replies[req[2]]; ok {
+				printer.Write([]byte{b})
+			}
+		}
+	}()
+	return newStatusReader(client)
+}
+
+func TestPoll(t *testing.T) {
+	tests := []struct {
+		name    string
+		replies map[byte]byte
+		want    model.PrinterState
+	}{
+		{"ready", map[byte]byte{
+			statusPrinter: 0x12, statusOffline: 0x12, statusError: 0x12, statusPaperRoll: 0x12,
+		}, model.PrinterState{}},
+		{"offline, cover open, paper end", map[byte]byte{
+			statusPrinter: 0x1A, statusOffline: 0x36, statusError: 0x12, statusPaperRoll: 0x12,
+		}, model.PrinterState{Offline: true, CoverOpen: true, PaperEnd: true}},
+		{"feed button, errors", map[byte]byte{
+			statusPrinter: 0x12, statusOffline: 0x1A, statusError: 0x7E, statusPaperRoll: 0x12,
+		}, model.PrinterState{FeedButton: true, MechanicalError: true, CutterError: true, UnrecoverableError: true, AutoRecoverableError: true}},
+		{"paper near end", map[byte]byte{
+			statusPrinter: 0x12, statusOffline: 0x12, statusError: 0x12, statusPaperRoll: 0x1E,
+		}, model.PrinterState{PaperNearEnd: true}},
+		{"paper end from roll sensor", map[byte]byte{
+			statusPrinter: 0x12, statusOffline: 0x12, statusError: 0x12, statusPaperRoll: 0x72,
+		}, model.PrinterState{PaperEnd: true}},
+		{"only printer status supported", map[byte]byte{
+			statusPrinter: 0x1A,
+		}, model.PrinterState{Offline: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := fakeStatusPrinter(t, tt.replies, nil)
+			got, ok := r.Poll()
+			if !ok || got != tt.want {
+				t.Fatalf("Poll = %+v, %v; want %+v, true", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestPollUnsupported(t *testing.T) {
+	r := fakeStatusPrinter(t, nil, nil)
+	if _, ok := r.Poll(); ok {
+		t.Fatal("Poll succeeded without a reply")
+	}
+}
+
+func TestPollStopsAfterTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		replies map[byte]byte
+		wantOK  bool
+	}{
+		{"no reply", nil, false},
+		{"only printer status supported", map[byte]byte{statusPrinter: 0x12}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := fakeStatusPrinter(t, tt.replies, nil)
+			start := time.Now()
+			if _, ok := r.Poll(); ok != tt.wantOK {
+				t.Fatalf("first Poll ok = %v, want %v", ok, tt.wantOK)
+			}
+			// One unanswered query, not one per status
+			if elapsed := time.Since(start); elapsed > statusQueryTimeout*3/2 {
+				t.Fatalf("first Poll took %v, want a single timeout", elapsed)
+			}
+
+			start = time.Now()
+			if _, ok := r.Poll(); ok {
+				t.Fatal("Poll after a timeout asked the printer again")
+			}
+			if elapsed := time.Since(start); elapsed > statusQueryTimeout/2 {
+				t.Fatalf("second Poll took %v, want no wait", elapsed)
+			}
+		})
+	}
+}
+
+func TestStatusReaderSeparatesASB(t *testing.T) {
+	// The ASB frame arrives just before the DLE EOT reply; its trailing
+	// bytes look like replies but belong to the frame
+	asb := []byte{0x10, 0x00, 0x0C, 0x12}
+	r := fakeStatusPrinter(t, map[byte]byte{
+		statusPrinter: 0x1A, statusOffline: 0x12, statusError: 0x12, statusPaperRoll: 0x12,
+	}, asb)
+
+	got, ok := r.Poll()
+	if !ok || got != (model.PrinterState{Offline: true}) {
+		t.Fatalf("Poll = %+v, %v; want offline only", got, ok)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if state, ok := r.ASBState(); ok {
+			if !state.PaperEnd || state.Offline {
+				t.Fatalf("ASB state = %+v, want paper end only", state)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("ASB frame not decoded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestASBPaperEndIsSticky(t *testing.T) {
+	r := &statusReader{}
+	r.setASB(model.PrinterState{PaperEnd: true})
+	r.setASB(model.PrinterState{CoverOpen: true})
+
+	state, _ := r.ASBState()
+	if !state.PaperEnd || !state.CoverOpen {
+		t.Fatalf("ASB state = %+v, want paper end kept", state)
+	}
+}
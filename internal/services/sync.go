@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/utils"
+)
+
+// --- Printer Sync ---
+
+// SyncReport lists what a reconciliation with the server changed.
+type SyncReport struct {
+	Created   []string // added locally from the server
+	Updated   []string // updated locally from the server
+	Deleted   []string // removed locally after being deleted on the server
+	Pushed    []string // local-only printers registered on the server
+	Conflicts []string // changes that could not be applied to the other side
+}
+
+func (r SyncReport) Changed() bool {
+	return len(r.Created)+len(r.Updated)+len(r.Deleted)+len(r.Pushed) > 0
+}
+
+func (r SyncReport) String() string {
+	return fmt.Sprintf("%d created, %d updated, %d deleted, %d pushed, %d conflicts",
+		len(r.Created), len(r.Updated), len(r.Deleted), len(r.Pushed), len(r.Conflicts))
+}
+
+// syncEntry is a printer as it was on each side after the last sync. The
+// server may omit or normalize fields, so both versions are kept.
+type syncEntry struct {
+	Server model.Printer `json:"server"`
+	Local  model.Printer `json:"local"`
+}
+
+// syncStatePath is where the printers as of the last sync are kept, next to
+// the printers file. They tell which side changed since then.
+func syncStatePath(printersFile string) string {
+	return strings.TrimSuffix(printersFile, ".json") + ".sync.json"
+}
+
+// serverFields keeps the settings shared with the back office. Everything
+// else (renderer, template, fallback...) is local and never synced.
+func serverFields(p model.Printer) model.Printer {
+	return model.Printer{
+		Name:         p.Name,
+		IP:           p.IP,
+		Port:         p.Port,
+		Description:  p.Description,
+		IsEnabled:    p.IsEnabled,
+		TenantID:     p.TenantID,
+		RestaurantID: p.RestaurantID,
+		AgentKey:     p.AgentKey,
+		Type:         p.Type,
+		Size:         p.Size,
+	}
+}
+
+// withServerFields applies the shared settings of src to a local printer.
+func withServerFields(local model.Printer, src model.Printer) model.Printer {
+	local.Name = src.Name
+	local.IP = src.IP
+	local.Port = src.Port
+	local.Description = src.Description
+	local.IsEnabled = src.IsEnabled
+	local.TenantID = src.TenantID
+	local.RestaurantID = src.RestaurantID
+	local.AgentKey = src.AgentKey
+	local.Type = src.Type
+	if src.Size != 0 {
+		local.Size = src.Size
+	}
+	return local
+}
+
+// SyncPrinters reconciles the printers file with the back office: printers
+// are matched by agent key (by IP when a local printer has no key yet) and
+// compared with their state at the last sync, so server changes are applied
+// locally and local-only printers are registered. The API has no route to
+// update or delete a printer, so local edits and removals of registered
+// printers are reported as conflicts until the back office matches them.
+// Deletions that would leave none of the known printers are refused unless
+// allowDeleteAll is set. It returns the printers now configured locally.
+func SyncPrinters(ctx context.Context, config model.Config, allowDeleteAll bool) ([]model.Printer, SyncReport, error) {
+	var report SyncReport
+	printersFile := ctx.Value(model.ContextPrintersFile).(string)
+
+	remote, err := GetPrintersFromServer(ctx, config.APIKey)
+	if err != nil {
+		return nil, report, fmt.Errorf("failed to get printers from server: %w", err)
+	}
+	local, err := utils.LoadPrinters(ctx)
+	if err != nil {
+		return nil, report, fmt.Errorf("failed to load printers: %w", err)
+	}
+	base, err := loadSyncState(syncStatePath(printersFile))
+	if err != nil {
+		return nil, report, err
+	}
+
+	var result []model.Printer
+	matched := make([]bool, len(local))
+	state := make(map[string]syncEntry)
+	onServer := make(map[string]bool)
+
+	// A repeated agent key is left as it is: only the first entry is synced
+	duplicate := make([]bool, len(local))
+	firstWithKey := make(map[string]string)
+	for i, printer := range local {
+		if printer.AgentKey == "" {
+			continue
+		}
+		if first, seen := firstWithKey[printer.AgentKey]; seen {
+			duplicate[i], matched[i] = true, true
+			result = append(result, printer)
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("%s: same agent key as %s, remove one of them", printer.Name, first))
+			continue
+		}
+		firstWithKey[printer.AgentKey] = printer.Name
+	}
+
+	for _, server := range remote {
+		if server.AgentKey == "" {
+			continue
+		}
+		onServer[server.AgentKey] = true
+		previous, known := base[server.AgentKey]
+
+		i := indexForServerPrinter(local, matched, server)
+		if i < 0 {
+			if known {
+				// Removed locally (printers remove) after the last sync: not recreated, but still on the server
+				report.Conflicts = append(report.Conflicts, fmt.Sprintf("%s: removed locally, delete it in the back office too", server.Name))
+				state[server.AgentKey] = previous
+				continue
+			}
+			created := withServerFields(model.Printer{Size: utils.DefaultPrinterSize}, server)
+			result = append(result, created)
+			state[server.AgentKey] = syncEntry{Server: serverFields(server), Local: serverFields(created)}
+			report.Created = append(report.Created, server.Name)
+			continue
+		}
+		matched[i] = true
+		printer := local[i]
+
+		// Without a previous sync (or for a printer adopted by IP) the server wins
+		localChanged, serverChanged := false, true
+		if known && printer.AgentKey != "" {
+			localChanged = serverFields(printer) != previous.Local
+			serverChanged = serverFields(server) != previous.Server
+		}
+
+		unsynced := false
+		switch {
+		case serverFields(printer) == serverFields(server):
+			// Both sides agree, e.g. the back office was edited like the local printer
+		case localChanged && serverChanged:
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("%s: changed locally and on the server, keeping the server version", server.Name))
+			printer = applyServer(printer, server, &report)
+		case localChanged:
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("%s: changed locally, make the same change in the back office", server.Name))
+			unsynced = true
+		case serverChanged:
+			printer = applyServer(printer, server, &report)
+		}
+		entry := syncEntry{Server: serverFields(server), Local: serverFields(printer)}
+		if unsynced {
+			// Keep the old base so the local edit is reported until the back office matches it
+			entry.Local = previous.Local
+		}
+		result = append(result, printer)
+		state[server.AgentKey] = entry
+	}
+
+	// Printers known from the last sync that the server no longer lists
+	knownLocal, deleted := 0, 0
+	for i, printer := range local {
+		if duplicate[i] {
+			continue
+		}
+		if _, known := base[printer.AgentKey]; known && printer.AgentKey != "" {
+			knownLocal++
+			if !matched[i] && !onServer[printer.AgentKey] {
+				deleted++
+			}
+		}
+	}
+	keepDeleted := deleted > 0 && !allowDeleteAll && (len(remote) == 0 || deleted == knownLocal)
+	if keepDeleted {
+		report.Conflicts = append(report.Conflicts, fmt.Sprintf("%d printer(s) deleted on the server would leave none locally, not deleting them without confirmation (printers sync --delete-all)", deleted))
+	}
+
+	for i, printer := range local {
+		if matched[i] {
+			continue
+		}
+
+		switch previous, known := base[printer.AgentKey]; {
+		case printer.AgentKey == "":
+			// Local-only printer: register it so the back office knows it
+			if printer.TenantID == 0 {
+				printer.TenantID = config.TenantID
+			}
+			if printer.RestaurantID == 0 {
+				printer.RestaurantID = config.RestaurantID
+			}
+			if err := RegisterPrinterOnServer(ctx, &printer, config.APIKey); err != nil {
+				log.Printf("[sync] Failed to register %s: %v", printer.Name, err)
+			} else {
+				report.Pushed = append(report.Pushed, printer.Name)
+				state[printer.AgentKey] = syncEntry{Server: serverFields(printer), Local: serverFields(printer)}
+			}
+			result = append(result, printer)
+		case known && keepDeleted:
+			state[printer.AgentKey] = previous
+			result = append(result, printer)
+		case known:
+			report.Deleted = append(report.Deleted, printer.Name)
+		default:
+			report.Conflicts = append(report.Conflicts, fmt.Sprintf("%s: agent key unknown to the server, keeping it", printer.Name))
+			result = append(result, printer)
+		}
+	}
+
+	// Rewriting an unchanged file would trigger a reload of the running agents
+	if !samePrinters(result, local) {
+		if err := utils.WritePrinters(printersFile, result); err != nil {
+			return nil, report, err
+		}
+	}
+	if err := saveSyncState(syncStatePath(printersFile), state); err != nil {
+		return result, report, err
+	}
+	return result, report, nil
+}
+
+// applyServer takes the server settings, reporting an update if anything changed.
+func applyServer(printer model.Printer, server model.Printer, report *SyncReport) model.Printer {
+	updated := withServerFields(printer, server)
+	if updated != printer {
+		report.Updated = append(report.Updated, server.Name)
+	}
+	return updated
+}
+
+// samePrinters reports whether a and b hold the same printers, in any order.
+func samePrinters(a, b []model.Printer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[model.Printer]int, len(a))
+	for _, p := range a {
+		counts[p]++
+	}
+	for _, p := range b {
+		if counts[p] == 0 {
+			return false
+		}
+		counts[p]--
+	}
+	return true
+}
+
+// indexForServerPrinter finds the local entry of a server printer: same agent
+// key, or same IP for a local printer not registered yet.
+func indexForServerPrinter(local []model.Printer, matched []bool, server model.Printer) int {
+	for i, p := range local {
+		if !matched[i] && p.AgentKey == server.AgentKey {
+			return i
+		}
+	}
+	for i, p := range local {
+		if !matched[i] && p.AgentKey == "" && p.IP == server.IP {
+			return i
+		}
+	}
+	return -1
+}
+
+func loadSyncState(path string) (map[string]syncEntry, error) {
+	state := make(map[string]syncEntry)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync state: %v", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal sync state %s: %v", path, err)
+	}
+	return state, nil
+}
+
+func saveSyncState(path string, state map[string]syncEntry) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write sync state: %v", err)
+	}
+	return os.Rename(tmpPath, path)
+}
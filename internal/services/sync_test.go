@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/utils"
+)
+
+// fakeBackOffice serves GET and POST /api/printers from an in-memory list,
+// the only printer routes of the back office.
+type fakeBackOffice struct {
+	mu         sync.Mutex
+	printers   []model.Printer
+	body       string   // raw GET response, overrides printers when set
+	unexpected []string // any other request
+	nextKey    int
+}
+
+func (b *fakeBackOffice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case r.URL.Path != "/api/printers":
+		b.unexpected = append(b.unexpected, r.Method+" "+r.URL.Path)
+		http.NotFound(w, r)
+	case r.Method == "GET":
+		if b.body != "" {
+			io.WriteString(w, b.body)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"printers": b.printers}})
+	case r.Method == "POST":
+		var p model.Printer
+		json.NewDecoder(r.Body).Decode(&p)
+		b.nextKey++
+		p.AgentKey = "new-" + string(rune('0'+b.nextKey))
+		b.printers = append(b.printers, p)
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"agent_key": p.AgentKey}})
+	default:
+		b.unexpected = append(b.unexpected, r.Method+" "+r.URL.Path)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (b *fakeBackOffice) set(printers ...model.Printer) {
+	b.mu.Lock()
+	b.printers = append([]model.Printer{}, printers...)
+	b.mu.Unlock()
+}
+
+type syncFixture struct {
+	t       *testing.T
+	ctx     context.Context
+	file    string
+	backend *fakeBackOffice
+}
+
+func newSyncFixture(t *testing.T, local ...model.Printer) *syncFixture {
+	backend := &fakeBackOffice{}
+	srv := httptest.NewServer(backend)
+	t.Cleanup(srv.Close)
+
+	file := filepath.Join(t.TempDir(), "printers.json")
+	if err := utils.WritePrinters(file, local); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), model.ContextAPIURL, srv.URL)
+	ctx = context.WithValue(ctx, model.ContextPrintersFile, file)
+	return &syncFixture{t: t, ctx: ctx, file: file, backend: backend}
+}
+
+func (f *syncFixture) sync(allowDeleteAll bool) SyncReport {
+	f.t.Helper()
+	_, report, err := SyncPrinters(f.ctx, model.Config{TenantID: 1}, allowDeleteAll)
+	if err != nil {
+		f.t.Fatalf("SyncPrinters: %v", err)
+	}
+	return report
+}
+
+func (f *syncFixture) local() []model.Printer {
+	f.t.Helper()
+	printers, err := utils.LoadPrinters(f.ctx)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return printers
+}
+
+func (f *syncFixture) write(printers ...model.Printer) {
+	f.t.Helper()
+	if err := utils.WritePrinters(f.file, printers); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+var (
+	kitchen = model.Printer{Name: "Kitchen", IP: "10.0.0.10", Port: 9100, IsEnabled: true, AgentKey: "k1", Type: model.PrinterTypeThermal, Size: 576}
+	bar     = model.Printer{Name: "Bar", IP: "10.0.0.11", Port: 9100, IsEnabled: true, AgentKey: "k2", Type: model.PrinterTypeThermal, Size: 576}
+)
+
+func TestSyncRejectsIncompleteServerList(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"missing printers", `{"data":{}}`},
+		{"null printers", `{"data":{"printers":null}}`},
+		{"changed envelope", `{"printers":[]}`},
+		{"undecodable entry", `{"data":{"printers":[{"name":"Kitchen","agent_key":"k1"},{"name":42}]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSyncFixture(t, kitchen)
+			f.backend.set(kitchen)
+			f.sync(false)
+
+			f.backend.body = tt.body
+			if _, _, err := SyncPrinters(f.ctx, model.Config{}, false); err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := f.local(); len(got) != 1 {
+				t.Fatalf("local printers = %v, want them untouched", got)
+			}
+		})
+	}
+}
+
+func TestSyncEmptyServerListNeedsConfirmation(t *testing.T) {
+	f := newSyncFixture(t, kitchen, bar)
+	f.backend.set(kitchen, bar)
+	f.sync(false)
+
+	f.backend.set()
+	report := f.sync(false)
+	if len(report.Deleted) != 0 || len(report.Conflicts) != 1 {
+		t.Fatalf("report = %+v, want no deletion and one conflict", report)
+	}
+	if got := f.local(); len(got) != 2 {
+		t.Fatalf("local printers = %d, want 2", len(got))
+	}
+
+	report = f.sync(true)
+	if len(report.Deleted) != 2 || len(f.local()) != 0 {
+		t.Fatalf("report = %+v, want both printers deleted once confirmed", report)
+	}
+}
+
+func TestSyncDeletesSinglePrinterRemovedOnServer(t *testing.T) {
+	f := newSyncFixture(t, kitchen, bar)
+	f.backend.set(kitchen, bar)
+	f.sync(false)
+
+	f.backend.set(kitchen)
+	report := f.sync(false)
+	if len(report.Deleted) != 1 || report.Deleted[0] != "Bar" {
+		t.Fatalf("deleted = %v, want [Bar]", report.Deleted)
+	}
+	if got := f.local(); len(got) != 1 || got[0].AgentKey != "k1" {
+		t.Fatalf("local printers = %v", got)
+	}
+}
+
+func TestSyncReportsLocalEdit(t *testing.T) {
+	f := newSyncFixture(t, kitchen)
+	f.backend.set(kitchen)
+	f.sync(false)
+
+	edited := kitchen
+	edited.IP = "10.0.0.20"
+	edited.Renderer = model.RendererText
+	f.write(edited)
+
+	// Reported on every sync, the local edit is kept meanwhile
+	for i := 0; i < 2; i++ {
+		if report := f.sync(false); report.Changed() || len(report.Conflicts) != 1 {
+			t.Fatalf("sync %d report = %+v, want one conflict", i, report)
+		}
+		if got := f.local(); got[0].IP != "10.0.0.20" || got[0].Renderer != model.RendererText {
+			t.Fatalf("local printer = %+v, want the local edit kept", got[0])
+		}
+	}
+
+	// Made in the back office as well: in sync again
+	server := kitchen
+	server.IP = "10.0.0.20"
+	f.backend.set(server)
+	if report := f.sync(false); report.Changed() || len(report.Conflicts) != 0 {
+		t.Fatalf("report = %+v once the back office matches", report)
+	}
+	if got := f.local(); got[0].Renderer != model.RendererText {
+		t.Errorf("local printer = %+v, want the local settings kept", got[0])
+	}
+	if len(f.backend.unexpected) != 0 {
+		t.Fatalf("unexpected requests: %v", f.backend.unexpected)
+	}
+}
+
+func TestSyncReportsLocalDelete(t *testing.T) {
+	f := newSyncFixture(t, kitchen, bar)
+	f.backend.set(kitchen, bar)
+	f.sync(false)
+
+	// Reported, but neither deleted on the server nor recreated locally
+	f.write(kitchen)
+	for i := 0; i < 2; i++ {
+		report := f.sync(false)
+		if report.Changed() || len(report.Conflicts) != 1 || !strings.Contains(report.Conflicts[0], "Bar") {
+			t.Fatalf("sync %d report = %+v, want one conflict for Bar", i, report)
+		}
+		if got := f.local(); len(got) != 1 {
+			t.Fatalf("local printers = %v, want Bar not recreated", got)
+		}
+	}
+	if len(f.backend.unexpected) != 0 {
+		t.Fatalf("unexpected requests: %v", f.backend.unexpected)
+	}
+
+	// Deleted in the back office as well: nothing left to report
+	f.backend.set(kitchen)
+	if report := f.sync(false); report.Changed() || len(report.Conflicts) != 0 {
+		t.Fatalf("report = %+v once the back office matches", report)
+	}
+}
+
+func TestSyncConflictKeepsServerVersion(t *testing.T) {
+	f := newSyncFixture(t, kitchen)
+	f.backend.set(kitchen)
+	f.sync(false)
+
+	local := kitchen
+	local.Name = "Kitchen (local)"
+	f.write(local)
+	server := kitchen
+	server.Name = "Kitchen (server)"
+	f.backend.set(server)
+
+	report := f.sync(false)
+	if len(report.Conflicts) != 1 || len(f.backend.unexpected) != 0 {
+		t.Fatalf("report = %+v, unexpected requests = %v", report, f.backend.unexpected)
+	}
+	if got := f.local(); got[0].Name != "Kitchen (server)" {
+		t.Fatalf("name = %q, want the server version", got[0].Name)
+	}
+}
+
+func TestSyncRegistersLocalOnlyPrinter(t *testing.T) {
+	local := kitchen
+	local.AgentKey = ""
+	f := newSyncFixture(t, local)
+	f.backend.set()
+
+	report := f.sync(false)
+	if len(report.Pushed) != 1 {
+		t.Fatalf("pushed = %v", report.Pushed)
+	}
+	got := f.local()
+	if len(got) != 1 || got[0].AgentKey == "" || got[0].TenantID != 1 {
+		t.Fatalf("local printers = %+v, want the printer registered", got)
+	}
+
+	// Known on both sides afterwards: nothing to do
+	if report := f.sync(false); report.Changed() || len(report.Conflicts) != 0 {
+		t.Fatalf("second sync report = %+v", report)
+	}
+}
+
+func TestSyncCreatesServerPrinterWithDefaultSize(t *testing.T) {
+	f := newSyncFixture(t)
+	server := bar
+	server.Size = 0
+	f.backend.set(server)
+
+	if report := f.sync(false); len(report.Created) != 1 {
+		t.Fatalf("created = %v", report.Created)
+	}
+	if got := f.local(); got[0].Size != utils.DefaultPrinterSize {
+		t.Fatalf("size = %d", got[0].Size)
+	}
+	// The defaulted size is not a local change
+	if report := f.sync(false); report.Changed() || len(report.Conflicts) != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+func TestSyncServerPrinterWithoutIsEnabled(t *testing.T) {
+	f := newSyncFixture(t)
+	f.backend.body = `{"data":{"printers":[{"name":"Kitchen","ip":"10.0.0.10","port":9100,"agent_key":"k1","size":576}]}}`
+
+	if report := f.sync(false); len(report.Created) != 1 {
+		t.Fatalf("created = %v", report.Created)
+	}
+	if got := f.local(); !got[0].IsEnabled {
+		t.Fatal("printer without isEnabled was disabled")
+	}
+	if report := f.sync(false); report.Changed() || len(report.Conflicts) != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+}
+
+func TestSyncLeavesUnchangedFileAlone(t *testing.T) {
+	f := newSyncFixture(t, kitchen, bar)
+	f.backend.set(bar, kitchen)
+	f.sync(false)
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(f.file, old, old); err != nil {
+		t.Fatal(err)
+	}
+	f.sync(false)
+	info, err := os.Stat(f.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Fatal("printers file rewritten although nothing changed")
+	}
+}
+
+func TestSyncIgnoresDuplicateAgentKey(t *testing.T) {
+	copied := bar
+	copied.Name, copied.IP = "Bar (copy)", "10.0.0.30"
+	f := newSyncFixture(t, kitchen, bar, copied)
+	f.backend.set(kitchen, bar)
+	if report := f.sync(false); report.Changed() || len(report.Conflicts) != 1 {
+		t.Fatalf("report = %+v, want only the duplicate reported", report)
+	}
+
+	// Bar deleted on the server: the copy is neither counted nor deleted with it
+	f.backend.set(kitchen)
+	report := f.sync(false)
+	if len(report.Deleted) != 1 || report.Deleted[0] != "Bar" {
+		t.Fatalf("deleted = %v, want [Bar]", report.Deleted)
+	}
+	got := f.local()
+	if len(got) != 2 || !slices.ContainsFunc(got, func(p model.Printer) bool { return p.Name == copied.Name }) {
+		t.Fatalf("local printers = %+v, want Kitchen and the copy kept", got)
+	}
+}
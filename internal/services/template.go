@@ -0,0 +1,218 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+// --- Local Ticket Templates ---
+
+// Layouts accepted for Order.CreatedAt, most specific first
+var orderDateLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+var templateFuncs = template.FuncMap{
+	"formatDate":  formatDate,
+	"formatMoney": formatMoney,
+}
+
+// formatDate prints an order timestamp as "02/01/2006 15:04" in local time.
+// Unparseable values are printed as they came from the server.
+func formatDate(value string) string {
+	for _, layout := range orderDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Local().Format("02/01/2006 15:04")
+		}
+	}
+	return value
+}
+
+// formatMoney prints an amount the Italian way: 1.234,50
+func formatMoney(value model.Money) string {
+	cents := int64(math.Round(float64(value) * 100))
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	units := strconv.FormatInt(cents/100, 10)
+	var grouped strings.Builder
+	for i, digit := range units {
+		if i > 0 && (len(units)-i)%3 == 0 {
+			grouped.WriteByte('.')
+		}
+		grouped.WriteRune(digit)
+	}
+
+	return fmt.Sprintf("%s%s,%02d", sign, grouped.String(), cents%100)
+}
+
+// --- Template Set ---
+
+// TemplateSet holds every ticket layout found in the templates directory,
+// keyed by file name without extension (e.g. "order", "kitchen", "bar").
+type TemplateSet struct {
+	defaultName string
+	templates   map[string]*template.Template
+}
+
+var (
+	ticketTemplates   *TemplateSet
+	ticketTemplatesMu sync.RWMutex
+)
+
+func templateName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// LoadTemplates parses every *.html file in the configured template directory.
+// It fails if any template does not parse or the default one is missing.
+func LoadTemplates(ctx context.Context) (*TemplateSet, error) {
+	templatePath, _ := ctx.Value(model.TemplatePath).(string)
+	templateFile, _ := ctx.Value(model.TemplateFile).(string)
+
+	files, err := filepath.Glob(filepath.Join(templatePath, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &TemplateSet{
+		defaultName: templateName(templateFile),
+		templates:   make(map[string]*template.Template),
+	}
+	for _, file := range files {
+		tmpl, err := template.New(filepath.Base(file)).Funcs(templateFuncs).ParseFiles(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %w", file, err)
+		}
+		ts.templates[templateName(filepath.Base(file))] = tmpl
+	}
+
+	if !ts.Has(ts.defaultName) {
+		return nil, fmt.Errorf("default template %s not found in %s", templateFile, templatePath)
+	}
+
+	ticketTemplatesMu.Lock()
+	ticketTemplates = ts
+	ticketTemplatesMu.Unlock()
+	return ts, nil
+}
+
+func getTemplates(ctx context.Context) (*TemplateSet, error) {
+	ticketTemplatesMu.RLock()
+	ts := ticketTemplates
+	ticketTemplatesMu.RUnlock()
+	if ts != nil {
+		return ts, nil
+	}
+	return LoadTemplates(ctx)
+}
+
+func (ts *TemplateSet) Has(name string) bool {
+	_, ok := ts.templates[templateName(name)]
+	return ok
+}
+
+// Names returns the loaded template names.
+func (ts *TemplateSet) Names() []string {
+	names := make([]string, 0, len(ts.templates))
+	for name := range ts.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select picks the layout for a job, first match wins:
+//  1. the template configured on the printer
+//  2. Metadata.TemplateName sent by the server
+//  3. a template named after Metadata.Category (e.g. "bar")
+//  4. the default template
+//
+// The printer comes first so a station layout (e.g. a kitchen ticket
+// without prices) is never replaced by what the server asks for.
+func (ts *TemplateSet) Select(p model.Printer, meta model.Metadata) string {
+	candidates := []string{p.Template, meta.TemplateName, meta.Category}
+	for _, name := range candidates {
+		if name != "" && ts.Has(name) {
+			return templateName(name)
+		}
+	}
+	return ts.defaultName
+}
+
+func (ts *TemplateSet) Render(name string, order *model.Order) (string, error) {
+	tmpl, ok := ts.templates[templateName(name)]
+	if !ok {
+		return "", fmt.Errorf("template %s not found", name)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, order); err != nil {
+		return "", fmt.Errorf("failed to execute template %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// ValidatePrinterTemplates makes sure every template referenced by a printer exists.
+func ValidatePrinterTemplates(ts *TemplateSet, printers []model.Printer) error {
+	var missing []string
+	for _, p := range printers {
+		if p.Template != "" && !ts.Has(p.Template) {
+			missing = append(missing, fmt.Sprintf("%s (printer %s)", p.Template, p.Name))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("unknown templates: %s (available: %s)",
+			strings.Join(missing, ", "), strings.Join(ts.Names(), ", "))
+	}
+	return nil
+}
+
+// --- Ticket Banners ---
+
+// addBanner puts a large centered line at the top of the ticket HTML.
+func addBanner(htmlContent string, text string) string {
+	banner := fmt.Sprintf(`<div style="text-align: center; border: 3px solid #000; margin-bottom: 10px;"><h1>%s</h1></div>`,
+		template.HTMLEscapeString(text))
+
+	lower := strings.ToLower(htmlContent)
+	if i := strings.Index(lower, "<body"); i >= 0 {
+		if end := strings.Index(lower[i:], ">"); end >= 0 {
+			pos := i + end + 1
+			return htmlContent[:pos] + banner + htmlContent[pos:]
+		}
+	}
+	return banner + htmlContent
+}
+
+// renderOrderTemplate executes the template selected for this printer and job.
+func renderOrderTemplate(ctx context.Context, p model.Printer, data model.PrinterData) (string, error) {
+	ts, err := getTemplates(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	name := ts.Select(p, data.Metadata)
+	log.Printf("[%s] Rendering order with template %s", p.Name, name)
+	return ts.Render(name, data.Order)
+}
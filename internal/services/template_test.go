@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func loadTestTemplates(t *testing.T, names ...string) *TemplateSet {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		content := `<p>` + name + ` {{.ID}}</p>`
+		if err := os.WriteFile(filepath.Join(dir, name+".html"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.WithValue(context.Background(), model.TemplatePath, dir)
+	ctx = context.WithValue(ctx, model.TemplateFile, "order.html")
+	ts, err := LoadTemplates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func TestTemplateSelect(t *testing.T) {
+	ts := loadTestTemplates(t, "order", "kitchen", "bar")
+
+	tests := []struct {
+		name     string
+		printer  string
+		server   string
+		category string
+		want     string
+	}{
+		{"default", "", "", "", "order"},
+		{"printer", "kitchen", "", "", "kitchen"},
+		{"printer wins over server", "kitchen", "order", "bar", "kitchen"},
+		{"server", "", "bar", "", "bar"},
+		{"server wins over category", "", "order", "bar", "order"},
+		{"category", "", "", "Bar", "bar"},
+		{"unknown names are skipped", "", "receipt", "pizza", "order"},
+		{"case and extension", " Kitchen.html ", "", "", "kitchen"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := model.Printer{Name: "Kitchen", Template: tt.printer}
+			meta := model.Metadata{TemplateName: tt.server, Category: tt.category}
+			if got := ts.Select(p, meta); got != tt.want {
+				t.Fatalf("Select = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTemplatesNeedsDefault(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kitchen.html"), []byte(`<p></p>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), model.TemplatePath, dir)
+	ctx = context.WithValue(ctx, model.TemplateFile, "order.html")
+	if _, err := LoadTemplates(ctx); err == nil {
+		t.Fatal("LoadTemplates without order.html succeeded")
+	}
+}
+
+func TestValidatePrinterTemplates(t *testing.T) {
+	ts := loadTestTemplates(t, "order", "kitchen")
+
+	valid := []model.Printer{{Name: "Kitchen", Template: "kitchen"}, {Name: "Bar"}}
+	if err := ValidatePrinterTemplates(ts, valid); err != nil {
+		t.Fatalf("ValidatePrinterTemplates = %v, want nil", err)
+	}
+	invalid := append(valid, model.Printer{Name: "Terrace", Template: "terrace"})
+	if err := ValidatePrinterTemplates(ts, invalid); err == nil {
+		t.Fatal("unknown template was accepted")
+	}
+}
+
+func TestFormatMoney(t *testing.T) {
+	tests := map[model.Money]string{
+		0:        "0,00",
+		9.5:      "9,50",
+		1234.5:   "1.234,50",
+		1000000:  "1.000.000,00",
+		-12.345:  "-12,35",
+		0.005001: "0,01",
+	}
+	for value, want := range tests {
+		if got := formatMoney(value); got != want {
+			t.Errorf("formatMoney(%v) = %q, want %q", float64(value), got, want)
+		}
+	}
+}
+
+// goldenOrder has every section of templates/order.html: table, notes,
+// plates with products and drinks, with amounts as numbers and strings.
+const goldenOrder = `{
+	"id": 41, "nOrder": 12, "year": 2024, "status": "in preparazione",
+	"createdAt": "2024-05-01T19:30:00Z", "notes": "Allergia alle noci",
+	"totalAmount": "1234.5",
+	"restaurant": {"id": 1, "name": "Da Mario", "description": "Trattoria & pizzeria"},
+	"table": {"id": 3, "number": 7, "capacity": 4},
+	"plates": [
+		{"lineId": 1, "plate": {"id": 10, "name": "Margherita"}, "quantity": 2, "unitPrice": 8, "subtotal": "16.00", "notes": "ben cotta",
+		 "orderPlateProducts": [{"product": {"id": 5, "name": "Bufala"}, "quantity": 1, "subtotal": 2.5}]},
+		{"lineId": 2, "plate": {"id": 11, "name": "Carbonara"}, "quantity": 1, "unitPrice": "12.00", "subtotal": 12}
+	],
+	"drinks": [
+		{"lineId": 3, "drink": {"id": 20, "name": "Acqua <frizzante>"}, "quantity": 1, "unitPrice": null, "subtotal": 0}
+	]
+}`
+
+func TestRenderOrderGolden(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC // formatDate prints local time
+	t.Cleanup(func() { time.Local = local })
+
+	ctx := context.WithValue(context.Background(), model.TemplatePath, filepath.Join("..", "..", "templates"))
+	ctx = context.WithValue(ctx, model.TemplateFile, "order.html")
+	ts, err := LoadTemplates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		golden string
+		edit   func(o *model.Order)
+	}{
+		{"dine in", "order.golden.html", func(o *model.Order) {}},
+		{"takeaway", "order_takeaway.golden.html", func(o *model.Order) {
+			o.Table, o.Notes, o.Drinks = nil, "", nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var order model.Order
+			if err := json.Unmarshal([]byte(goldenOrder), &order); err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(&order)
+			got, err := ts.Render("order", &order)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", tt.golden)
+			if *updateGolden {
+				if err := os.MkdirAll("testdata", 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Fatalf("rendered order differs from %s (run go test -update after checking the change):\n%s", golden, got)
+			}
+		})
+	}
+}
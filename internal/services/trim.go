@@ -0,0 +1,83 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+const (
+	dotsPerMM      = 8   // 203 dpi thermal head
+	blankThreshold = 250 // rows lighter than this everywhere are blank
+	maxBlankRunMM  = 6   // longer vertical gaps are shortened to this
+)
+
+// --- Blank Margin Trimming ---
+
+// trimImage removes blank rows above and below the ticket content, shortens
+// long blank gaps inside it and adds the requested margins (in millimetres).
+// Chrome screenshots include the page padding, which would waste paper.
+func trimImage(img image.Image, topMM, bottomMM float64) image.Image {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	gray := toGrayscale(img, width, height)
+	blank := make([]bool, height)
+	first, last := -1, -1
+	for y := 0; y < height; y++ {
+		blank[y] = isBlankRow(gray[y*width : (y+1)*width])
+		if !blank[y] {
+			if first < 0 {
+				first = y
+			}
+			last = y
+		}
+	}
+	// Nothing to print: leave the image alone rather than sending an empty ticket
+	if first < 0 {
+		return img
+	}
+
+	maxRun := maxBlankRunMM * dotsPerMM
+	var rows []int
+	run := 0
+	for y := first; y <= last; y++ {
+		if blank[y] {
+			run++
+			if run > maxRun {
+				continue
+			}
+		} else {
+			run = 0
+		}
+		rows = append(rows, y)
+	}
+
+	top := mmToDots(topMM)
+	bottom := mmToDots(bottomMM)
+	dst := image.NewRGBA(image.Rect(0, 0, width, top+len(rows)+bottom))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	for i, y := range rows {
+		row := image.Rect(0, top+i, width, top+i+1)
+		draw.Draw(dst, row, img, image.Point{X: bounds.Min.X, Y: bounds.Min.Y + y}, draw.Over)
+	}
+	return dst
+}
+
+func isBlankRow(row []float64) bool {
+	for _, v := range row {
+		if v < blankThreshold {
+			return false
+		}
+	}
+	return true
+}
+
+func mmToDots(mm float64) int {
+	if mm <= 0 {
+		return 0
+	}
+	return int(mm*dotsPerMM + 0.5)
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// ticketImage is a white page of the given height with black rows at inked.
+func ticketImage(width, height int, inked ...int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for _, y := range inked {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.Black)
+		}
+	}
+	return img
+}
+
+// inkedRows returns the rows of img that contain a dark pixel.
+func inkedRows(img image.Image) []int {
+	bounds := img.Bounds()
+	gray := toGrayscale(img, bounds.Dx(), bounds.Dy())
+	var rows []int
+	for y := 0; y < bounds.Dy(); y++ {
+		if !isBlankRow(gray[y*bounds.Dx() : (y+1)*bounds.Dx()]) {
+			rows = append(rows, y)
+		}
+	}
+	return rows
+}
+
+func TestTrimImage(t *testing.T) {
+	maxRun := maxBlankRunMM * dotsPerMM
+
+	tests := []struct {
+		name       string
+		height     int
+		inked      []int
+		top        float64
+		bottom     float64
+		wantHeight int
+		wantInked  []int
+	}{
+		{"content only", 10, []int{0, 9}, 0, 0, 10, []int{0, 9}},
+		{"outer margins removed", 100, []int{40, 41}, 0, 0, 2, []int{0, 1}},
+		{"margins added", 100, []int{40}, 1, 2, 1 + 8 + 16, []int{8}},
+		{"short gap kept", 200, []int{10, 30}, 0, 0, 21, []int{0, 20}},
+		{"long gap shortened", 300, []int{10, 10 + maxRun + 100}, 0, 0, maxRun + 2, []int{0, maxRun + 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trimImage(ticketImage(16, tt.height, tt.inked...), tt.top, tt.bottom)
+			if h := got.Bounds().Dy(); h != tt.wantHeight {
+				t.Fatalf("height = %d, want %d", h, tt.wantHeight)
+			}
+			if w := got.Bounds().Dx(); w != 16 {
+				t.Fatalf("width = %d, want 16", w)
+			}
+			rows := inkedRows(got)
+			if len(rows) != len(tt.wantInked) {
+				t.Fatalf("inked rows = %v, want %v", rows, tt.wantInked)
+			}
+			for i := range rows {
+				if rows[i] != tt.wantInked[i] {
+					t.Fatalf("inked rows = %v, want %v", rows, tt.wantInked)
+				}
+			}
+		})
+	}
+}
+
+func TestTrimImageBlankPage(t *testing.T) {
+	img := ticketImage(16, 50)
+	if got := trimImage(img, 2, 2); got != image.Image(img) {
+		t.Fatal("blank page was changed, want it left alone")
+	}
+}
+
+func TestTrimImageKeepsLightGray(t *testing.T) {
+	// Rows just under the blank threshold are content (e.g. light logos)
+	img := ticketImage(16, 20)
+	for x := 0; x < 16; x++ {
+		img.Set(x, 5, color.Gray{Y: blankThreshold - 5})
+	}
+	if got := trimImage(img, 0, 0); got.Bounds().Dy() != 1 {
+		t.Fatalf("height = %d, want the light row kept", got.Bounds().Dy())
+	}
+}
+
+func TestMMToDots(t *testing.T) {
+	for mm, want := range map[float64]int{-1: 0, 0: 0, 1: 8, 2.5: 20, 0.06: 0} {
+		if got := mmToDots(mm); got != want {
+			t.Errorf("mmToDots(%v) = %d, want %d", mm, got, want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+const (
+	writerQueueSize          = 64
+	defaultHeartbeatInterval = 20 * time.Second
+	defaultWriteTimeout      = 10 * time.Second
+)
+
+// --- Heartbeats ---
+
+// heartbeat configures client-initiated WebSocket pings. If no pong (or any
+// other message) arrives within timeout, the connection is considered dead.
+type heartbeat struct {
+	interval     time.Duration
+	timeout      time.Duration
+	writeTimeout time.Duration
+}
+
+func heartbeatFor(config model.Config) heartbeat {
+	hb := heartbeat{
+		interval:     defaultHeartbeatInterval,
+		writeTimeout: defaultWriteTimeout,
+	}
+	if config.HeartbeatIntervalSeconds > 0 {
+		hb.interval = time.Duration(config.HeartbeatIntervalSeconds) * time.Second
+	}
+	// By default two pings may be lost before giving up
+	hb.timeout = hb.interval*2 + hb.interval/2
+	if config.HeartbeatTimeoutSeconds > 0 {
+		hb.timeout = time.Duration(config.HeartbeatTimeoutSeconds) * time.Second
+	}
+	return hb
+}
+
+// watchConnection arms the read deadline and extends it on every pong.
+// Call extendReadDeadline after each message read to count it as a sign of life.
+func (hb heartbeat) watchConnection(conn *websocket.Conn) {
+	hb.extendReadDeadline(conn)
+	conn.SetPongHandler(func(string) error {
+		hb.extendReadDeadline(conn)
+		return nil
+	})
+}
+
+func (hb heartbeat) extendReadDeadline(conn *websocket.Conn) {
+	conn.SetReadDeadline(time.Now().Add(hb.timeout))
+}
+
+// --- WebSocket Writer ---
+
+// outboundMessage is a JSON message waiting to be written to the socket.
+// result, when set, receives the outcome of the write.
+type outboundMessage struct {
+	payload interface{}
+	result  chan error
+}
+
+// wsWriter owns all writes on a connection: gorilla/websocket forbids
+// concurrent writers, so pongs, acks and registrations go through one channel.
+type wsWriter struct {
+	conn *websocket.Conn
+	hb   heartbeat
+	out  chan outboundMessage
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newWSWriter(conn *websocket.Conn, hb heartbeat) *wsWriter {
+	w := &wsWriter{
+		conn: conn,
+		hb:   hb,
+		out:  make(chan outboundMessage, writerQueueSize),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *wsWriter) run() {
+	defer w.drop()
+	defer close(w.done)
+
+	ping := time.NewTicker(w.hb.interval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ping.C:
+			deadline := time.Now().Add(w.hb.writeTimeout)
+			if err := w.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				log.Printf("[ws] Heartbeat ping failed: %v", err)
+				w.conn.Close()
+				return
+			}
+		case msg := <-w.out:
+			w.conn.SetWriteDeadline(time.Now().Add(w.hb.writeTimeout))
+			err := w.conn.WriteJSON(msg.payload)
+			if msg.result != nil {
+				msg.result <- err
+			}
+			if err != nil {
+				// Unblocks the read loop so the agent reconnects
+				w.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// Send queues a message and waits until it has been written.
+func (w *wsWriter) Send(payload interface{}) error {
+	msg := outboundMessage{payload: payload, result: make(chan error, 1)}
+
+	select {
+	case <-w.done:
+		return errNotConnected
+	default:
+	}
+
+	select {
+	case w.out <- msg:
+	case <-w.done:
+		return errNotConnected
+	}
+
+	select {
+	case err := <-msg.result:
+		return err
+	case <-w.done:
+		return errNotConnected
+	}
+}
+
+// drop discards the messages still queued when the writer stops, so callers
+// waiting in Send get errNotConnected and lost posts show up in the log.
+func (w *wsWriter) drop() {
+	for {
+		select {
+		case msg := <-w.out:
+			if msg.result != nil {
+				msg.result <- errNotConnected
+			} else {
+				log.Printf("[ws] Connection closed, dropped %T", msg.payload)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Post queues a message without waiting for the write.
+func (w *wsWriter) Post(payload interface{}) error {
+	// With room in the buffer both cases below are ready and select picks
+	// one at random: a stopped writer must never accept a message
+	select {
+	case <-w.done:
+		return errNotConnected
+	default:
+	}
+
+	select {
+	case w.out <- outboundMessage{payload: payload}:
+		return nil
+	case <-w.done:
+		return errNotConnected
+	}
+}
+
+// Close stops the writer and waits for it to exit.
+func (w *wsWriter) Close() {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+	<-w.done
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialTestSocket connects to a WebSocket server that reads until the client
+// leaves, passing every message to received when set.
+func dialTestSocket(t *testing.T, received chan<- []byte) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if received != nil {
+				received <- data
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// dialSilentSocket connects to a WebSocket server that never reads, so it
+// never answers pings, like the far end of a half-open connection.
+func dialSilentSocket(t *testing.T) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestHeartbeatDropsSilentConnection(t *testing.T) {
+	hb := heartbeat{interval: 20 * time.Millisecond, timeout: 100 * time.Millisecond, writeTimeout: time.Second}
+	conn := dialSilentSocket(t)
+	hb.watchConnection(conn)
+	w := newWSWriter(conn, hb)
+	defer w.Close()
+
+	start := time.Now()
+	_, _, err := conn.ReadMessage()
+	elapsed := time.Since(start)
+
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("read error = %v, want a timeout", err)
+	}
+	if elapsed > hb.timeout+time.Second {
+		t.Fatalf("connection dropped after %s, want about %s", elapsed, hb.timeout)
+	}
+}
+
+func TestHeartbeatKeepsAnsweringConnection(t *testing.T) {
+	hb := heartbeat{interval: 20 * time.Millisecond, timeout: 100 * time.Millisecond, writeTimeout: time.Second}
+	conn := dialTestSocket(t, nil) // answers every ping with a pong
+	hb.watchConnection(conn)
+	w := newWSWriter(conn, hb)
+	defer w.Close()
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, _, err := conn.ReadMessage()
+		readErr <- err
+	}()
+	select {
+	case err := <-readErr:
+		t.Fatalf("connection dropped although pongs arrived: %v", err)
+	case <-time.After(5 * hb.timeout):
+	}
+}
+
+func TestWSWriterSend(t *testing.T) {
+	w := newWSWriter(dialTestSocket(t, nil), heartbeat{interval: time.Hour, timeout: time.Hour, writeTimeout: time.Second})
+	defer w.Close()
+
+	if err := w.Send(map[string]string{"type": "ping"}); err != nil {
+		t.Fatalf("Send = %v, want nil", err)
+	}
+	if err := w.Post(map[string]string{"type": "pong"}); err != nil {
+		t.Fatalf("Post = %v, want nil", err)
+	}
+}
+
+func TestWSWriterRefusesAfterStop(t *testing.T) {
+	w := newWSWriter(dialTestSocket(t, nil), heartbeat{interval: time.Hour, timeout: time.Hour, writeTimeout: time.Second})
+	w.Close()
+
+	// The buffer has room, so a random select would accept some of these
+	for i := 0; i < 100; i++ {
+		if err := w.Post(map[string]string{"type": "pong"}); !errors.Is(err, errNotConnected) {
+			t.Fatalf("Post %d after stop = %v, want errNotConnected", i, err)
+		}
+	}
+	if err := w.Send(map[string]string{"type": "pong"}); !errors.Is(err, errNotConnected) {
+		t.Fatalf("Send after stop = %v, want errNotConnected", err)
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -10,7 +11,6 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
@@ -26,36 +26,175 @@ import (
 
 // --- WebSocket Agent Logic ---
 
-func RunAgent(ctx context.Context, p model.Printer, config model.Config) {
+// newPrintAgent opens the printer's job queue and print history and starts
+// its print worker. The agent survives reconnections and connection modes.
+func newPrintAgent(ctx context.Context, p model.Printer, config model.Config) (*printAgent, error) {
+	queueDir, _ := ctx.Value(model.ContextQueueDir).(string)
+	queue, err := OpenJobQueue(queueDir, p.AgentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job queue: %w", err)
+	}
+
+	retention := time.Duration(config.DedupeRetentionHours) * time.Hour
+	history, err := OpenPrintHistory(queueDir, p.AgentKey, retention)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open print history: %w", err)
+	}
+
+	version, _ := ctx.Value(model.ContextAppVersion).(string)
+	agent := &printAgent{
+		printer:       p,
+		config:        config,
+		queue:         queue,
+		history:       history,
+		queueDir:      queueDir,
+		version:       version,
+		lastPrintedAt: history.LastPrintedAt(),
+		statusChanged: make(chan struct{}, 1),
+		workerDone:    make(chan struct{}),
+	}
+	agent.paused.Store(IsPaused(queueDir, p.AgentKey))
+	if agent.Paused() {
+		log.Printf("[%s] Printer is paused, jobs are held until resumed.", p.Name)
+	}
+
+	go agent.runWorker(ctx)
+	go agent.runStatusReporter(ctx)
+	go agent.watchPaused(ctx)
+	return agent, nil
+}
+
+// sleepContext waits for d or until ctx is cancelled. It reports whether
+// the full duration elapsed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func dialServer(ctx context.Context, config model.Config) (*websocket.Conn, error) {
 	wsURL := ctx.Value(model.ContextWSURL).(string)
 	header := http.Header{}
 	header.Add("X-Api-Key", config.APIKey)
 
-	log.Printf("[%s] Connecting to WebSocket...", p.Name)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
+	return conn, err
+}
+
+// runAgentConnection keeps a dedicated WebSocket open for one printer,
+// moving through connecting -> registering -> registered and backing off
+// between attempts.
+func runAgentConnection(ctx context.Context, agent *printAgent) {
+	p := agent.printer
+	bo := newBackoff()
 
-	for {
-		conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	defer agent.setState(model.ConnStateDisconnected)
+
+	for ctx.Err() == nil {
+		agent.setState(model.ConnStateConnecting)
+		conn, err := dialServer(ctx, agent.config)
 		if err != nil {
-			log.Printf("[%s] Connection failed: %v. Retrying in 5s...", p.Name, err)
-			time.Sleep(5 * time.Second)
+			if ctx.Err() != nil {
+				return
+			}
+			wait := bo.Next()
+			agent.setState(model.ConnStateBackingOff)
+			log.Printf("[%s] Connection failed: %v. Retrying in %s...", p.Name, err, wait.Round(time.Millisecond))
+			sleepContext(ctx, wait)
 			continue
 		}
 
 		log.Printf("[%s] Connected.", p.Name)
-		handleConnection(ctx, conn, p)
+		handleConnection(ctx, conn, agent, bo)
 
 		conn.Close()
-		log.Printf("[%s] Disconnected. Reconnecting in 5s...", p.Name)
-		time.Sleep(5 * time.Second)
+		if ctx.Err() != nil {
+			log.Printf("[%s] Disconnected.", p.Name)
+			return
+		}
+		wait := bo.Next()
+		agent.setState(model.ConnStateBackingOff)
+		log.Printf("[%s] Disconnected. Reconnecting in %s...", p.Name, wait.Round(time.Millisecond))
+		sleepContext(ctx, wait)
+	}
+}
+
+// logReadError explains why the read loop stopped; a timeout means the
+// server stopped answering our heartbeats (e.g. half-open TCP connection).
+func logReadError(name string, err error) {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		log.Printf("[%s] Heartbeat missed, connection considered dead. Reconnecting...", name)
+		return
 	}
+	log.Printf("[%s] Read error: %v", name, err)
 }
 
-func handleConnection(ctx context.Context, conn *websocket.Conn, p model.Printer) {
+// closeOnShutdown waits for ctx to be cancelled, lets the agents' workers
+// finish their current job (so its ack still goes out), then unregisters
+// and closes the socket, which unblocks the read loop.
+func closeOnShutdown(ctx context.Context, conn *websocket.Conn, writer *wsWriter, agents []*printAgent, connDone <-chan struct{}) {
+	select {
+	case <-ctx.Done():
+	case <-connDone:
+		return
+	}
+
+	for _, a := range agents {
+		select {
+		case <-a.workerDone:
+		case <-connDone:
+			return
+		}
+	}
+
+	for _, a := range agents {
+		unregMsg := model.WSMessage{
+			Type:     model.MessageTypeUnregister,
+			AgentKey: a.printer.AgentKey,
+		}
+		if err := writer.Send(unregMsg); err != nil {
+			log.Printf("[%s] Failed to send unregister: %v", a.printer.Name, err)
+		} else {
+			log.Printf("[%s] Unregistered from server.", a.printer.Name)
+		}
+	}
+
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "agent shutting down")
+	conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+	conn.Close()
+}
+
+func handleConnection(ctx context.Context, conn *websocket.Conn, a *printAgent, bo *backoff) {
+	p := a.printer
+
+	// All writes go through a single goroutine; printing happens in the
+	// agent's worker, so this read loop only dispatches messages.
+	hb := heartbeatFor(a.config)
+	hb.watchConnection(conn)
+	writer := newWSWriter(conn, hb)
+	a.setWriter(writer)
+	defer func() {
+		a.setWriter(nil)
+		writer.Close()
+	}()
+
+	connDone := make(chan struct{})
+	defer close(connDone)
+	go closeOnShutdown(ctx, conn, writer, []*printAgent{a}, connDone)
+
+	a.setState(model.ConnStateRegistering)
 	regMsg := model.WSMessage{
 		Type:     model.MessageTypeRegister,
 		AgentKey: p.AgentKey,
 	}
-	if err := conn.WriteJSON(regMsg); err != nil {
+	if err := a.send(regMsg); err != nil {
 		log.Printf("[%s] Failed to send register: %v", p.Name, err)
 		return
 	}
@@ -64,13 +203,21 @@ func handleConnection(ctx context.Context, conn *websocket.Conn, p model.Printer
 		var msg model.WSMessage
 		err := conn.ReadJSON(&msg)
 		if err != nil {
-			log.Printf("[%s] Read error: %v", p.Name, err)
+			if ctx.Err() == nil {
+				logReadError(p.Name, err)
+			}
 			return
 		}
+		hb.extendReadDeadline(conn)
 
 		switch msg.Type {
 		case model.MessageTypeRegistered:
 			log.Printf("[%s] Successfully registered with server.", p.Name)
+			a.setState(model.ConnStateRegistered)
+			bo.Reset()
+			// Deliver results of jobs finished while we were offline
+			go a.flushReports()
+			a.resetStatus()
 
 		case model.MessageTypePing:
 			log.Printf("[%s] Received ping, sending pong...", p.Name)
@@ -78,11 +225,14 @@ func handleConnection(ctx context.Context, conn *websocket.Conn, p model.Printer
 				Type:      model.MessageTypePong,
 				Timestamp: time.Now().Unix(),
 			}
-			conn.WriteJSON(pongMsg)
+			a.post(pongMsg)
 
 		case model.MessageTypeNewOrder:
 			log.Printf("[%s] Received print order...", p.Name)
-			handlePrintJob(ctx, conn, p, msg.Order)
+			handlePrintJob(ctx, a, msg.Order)
+
+		case model.MessageTypePause, model.MessageTypeResume:
+			handlePauseRequest(a, msg.Type)
 
 		case model.MessageTypeUnregister:
 			log.Printf("[%s] Server requested unregister.", p.Name)
@@ -94,115 +244,128 @@ func handleConnection(ctx context.Context, conn *websocket.Conn, p model.Printer
 	}
 }
 
-func handlePrintJob(ctx context.Context, conn *websocket.Conn, p model.Printer, rawOrder json.RawMessage) {
-	// 1. Parse the specific JSON structure
+// handlePrintJob stores the order in the printer's queue; the worker prints it.
+func handlePrintJob(ctx context.Context, a *printAgent, rawOrder json.RawMessage) {
+	p := a.printer
+
+	// Parse the specific JSON structure
 	var payload model.OrderPayload
 	if err := json.Unmarshal(rawOrder, &payload); err != nil {
 		log.Printf("[%s] Error parsing order JSON: %v", p.Name, err)
+		failMsg := model.WSMessageTypePrintFailed{
+			Type:     model.MessageTypePrintFailed,
+			AgentKey: p.AgentKey,
+			OrderID:  payload.Data.Metadata.OrderId, // best effort, may be 0
+			Error:    fmt.Sprintf("invalid order payload: %v", err),
+		}
+		a.post(failMsg)
 		return
 	}
-	
-	// Ensure we have content to print
-	if payload.Data.Content == "" {
-		log.Printf("[%s] Received empty content, skipping.", p.Name)
+
+	// Split the order across stations when a routing table is configured
+	if parts := a.routeOrder(payload.Data); parts != nil {
+		a.dispatchParts(ctx, payload.Data.Metadata.OrderId, parts)
 		return
 	}
+	a.enqueueOrder(ctx, payload.Data)
+}
 
-	log.Printf("[%s] Processing Order ID: %d (Type: %s)", p.Name, payload.Data.Metadata.OrderId, p.Type)
-
-	// Ensure tmp directory exists
-	tmpDir := "tmp"
-	if _, err := os.Stat(tmpDir); os.IsNotExist(err) {
-		os.Mkdir(tmpDir, 0755)
+// enqueueOrder stores a print request in the printer's queue and returns its job.
+func (a *printAgent) enqueueOrder(ctx context.Context, data model.PrinterData) *model.PrintJob {
+	p := a.printer
+
+	now := time.Now()
+	job := &model.PrintJob{
+		ID:            fmt.Sprintf("%d-%d", data.Metadata.OrderId, now.UnixNano()),
+		AgentKey:      p.AgentKey,
+		OrderID:       data.Metadata.OrderId,
+		Data:          data,
+		Status:        model.JobStatusPending,
+		CreatedAt:     now,
+		NextAttemptAt: now,
 	}
 
-	// Determine number of copies (default to 1 if 0)
-	copies := payload.Data.Copies
-	if copies < 1 {
-		copies = 1
+	// The report of the queued job answers the redelivery once it has a result;
+	// acking now would claim printed before anything printed
+	if queued := a.queuedRequest(data); queued != nil {
+		log.Printf("[%s] Order %d is already queued (%s), not queuing it again", p.Name, queued.OrderID, queued.Status)
+		return queued
 	}
 
-	// 2. Generate IMG
-	fileName := fmt.Sprintf("%s_order_%d_%d.png", p.AgentKey, payload.Data.Metadata.OrderId, time.Now().Unix())
-	imgPath := filepath.Join(tmpDir, fileName)
-
-	err := generateOrderImage(ctx, payload.Data.Content, imgPath)
-	if err != nil {
-		log.Printf("[%s] Failed to generate IMG: %v", p.Name, err)
-		
-		failMsg := model.WSMessage{
-			Type:     model.MessageTypePrintFailed,
-			AgentKey: p.AgentKey,
-			Error:    err.Error(),
-		}
-		conn.WriteJSON(failMsg)
-		return
-	}
-	log.Printf("[%s] IMG generated: %s", p.Name, imgPath)
-
-	// 3. Send IMG to Printer (Loop for copies)
-	success := true
-	for i := 0; i < copies; i++ {
-		log.Printf("[%s] Printing copy %d of %d", p.Name, i+1, copies)
-		if err := sendFileToPrinter(p, imgPath); err != nil {
-			log.Printf("[%s] Failed to send to printer: %v", p.Name, err)
-			success = false
-			
-			failMsg := model.WSMessageTypePrintFailed{
-				Type:     model.MessageTypePrintFailed,
-				AgentKey: p.AgentKey,
-				OrderID:  payload.Data.Metadata.OrderId,
-				Error:    err.Error(),
+	// Redelivered orders that already printed are still acknowledged so the server stops resending them
+	if a.alreadyPrinted(data) {
+		job.Duplicate = true
+		if a.duplicatePolicy() == DuplicatePolicySkip {
+			log.Printf("[%s] Skipping duplicate order %d", p.Name, job.OrderID)
+			job.Status = model.JobStatusPrinted
+			job.FinishedAt = now
+			if err := a.queue.Enqueue(job); err != nil {
+				log.Printf("[%s] Warning: Failed to persist job for order %d: %v", p.Name, job.OrderID, err)
 			}
-			conn.WriteJSON(failMsg)
-			break
+			go a.report(job)
+			return job
 		}
+		log.Printf("[%s] Printing duplicate order %d with DUPLICATE banner", p.Name, job.OrderID)
 	}
 
-	if success {
-		regMsg := model.WSMessage{
-			Type:     model.MessageTypePrinted,
-			AgentKey: p.AgentKey,
-		}
-		if err := conn.WriteJSON(regMsg); err != nil {
-			log.Printf("[%s] Failed to send printed confirmation: %v", p.Name, err)
-		}
-		log.Printf("[%s] Order sent successfully!", p.Name)
+	if err := a.queue.Enqueue(job); err != nil {
+		log.Printf("[%s] Warning: Failed to persist job for order %d: %v", p.Name, job.OrderID, err)
+	}
+	log.Printf("[%s] Order %d queued (%d pending)", p.Name, job.OrderID, a.queue.Pending())
+	if a.Paused() {
+		log.Printf("[%s] Printer is paused: order %d will print once resumed.", p.Name, job.OrderID)
+	}
+	a.notifyStatus()
+	if ctx.Err() != nil {
+		log.Printf("[%s] Shutting down: order %d will be printed on next start.", p.Name, job.OrderID)
+	}
+	return job
+}
+
+// isThermal reports whether the printer speaks ESC/POS. Printers without a
+// type are thermal, as in sendFileToPrinter.
+func isThermal(p model.Printer) bool {
+	printerType := strings.ToLower(strings.TrimSpace(p.Type))
+	return printerType == model.PrinterTypeThermal || printerType == ""
+}
+
+// usesTextRenderer reports whether the printer gets native ESC/POS text
+// instead of a rasterized screenshot. Only thermal printers support it.
+func usesTextRenderer(p model.Printer) bool {
+	if strings.ToLower(strings.TrimSpace(p.Renderer)) != model.RendererText {
+		return false
 	}
+	return isThermal(p)
+}
 
-	// 4. Cleanup
-	if err := os.Remove(imgPath); err != nil {
-		log.Printf("[%s] Warning: Failed to delete tmp file: %v", p.Name, err)
-	} else {
-		log.Printf("[%s] Tmp file deleted.", p.Name)
+// RequiresChrome reports whether any registered printer renders tickets as images.
+func RequiresChrome(printers []model.Printer) bool {
+	for _, p := range printers {
+		if p.AgentKey != "" && !usesTextRenderer(p) {
+			return true
+		}
 	}
+	return false
 }
 
 func generateOrderImage(ctx context.Context, htmlContent string, outputPath string) error {
-	var cdpCtx context.Context
-	var cancel context.CancelFunc
-
-	// macOS: force Chrome path
-	if runtime.GOOS == "darwin" {
-		opts := append(
-			chromedp.DefaultExecAllocatorOptions[:],
-			chromedp.ExecPath("/Applications/Google Chrome.app/Contents/MacOS/Google Chrome"),
-			chromedp.Flag("no-sandbox", true),
-			chromedp.Flag("disable-gpu", true),
-		)
-
-		allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), opts...)
-		cdpCtx, cancel = chromedp.NewContext(allocCtx)
-		defer allocCancel()
-		defer cancel()
-	} else {
-		cdpCtx, cancel = chromedp.NewContext(context.Background())
-		defer cancel()
+	pool, err := getBrowserPool()
+	if err != nil {
+		return err
+	}
+	tab, err := pool.acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("no browser tab available: %w", err)
 	}
 
+	// Closing the tab is the only way to abort a running chromedp action;
+	// the pool then discards it instead of reusing it.
+	stop := context.AfterFunc(ctx, tab.cancel)
+	defer stop()
+
 	var pngBytes []byte
 
-	err := chromedp.Run(cdpCtx,
+	err = chromedp.Run(tab.ctx,
 		chromedp.Navigate("data:text/html,"+urlEncode(htmlContent)),
 		chromedp.Sleep(300*time.Millisecond),
 		chromedp.ActionFunc(func(ctx context.Context) error {
@@ -216,6 +379,7 @@ func generateOrderImage(ctx context.Context, htmlContent string, outputPath stri
 			return nil
 		}),
 	)
+	pool.release(tab, err == nil)
 
 	if err != nil {
 		return fmt.Errorf("failed generating image: %w", err)
@@ -233,50 +397,53 @@ func urlEncode(s string) string {
 }
 
 // --- MAIN DISPATCHER ---
-func sendFileToPrinter(p model.Printer, filePath string) error {
+func sendFileToPrinter(ctx context.Context, p model.Printer, filePath string) (int, error) {
 	// Normalize printer type to lowercase
 	printerType := strings.ToLower(strings.TrimSpace(p.Type))
 	
 	switch printerType {
 	case model.PrinterTypeThermal:
-		return sendToThermalPrinter(p, filePath)
+		return sendToThermalPrinter(ctx, p, filePath)
 	
 	case model.PrinterTypeInkjet, model.PrinterTypeLaser:
-		return sendToSystemPrinter(p, filePath)
+		return sendToSystemPrinter(ctx, p, filePath)
 	
 	case "":
 		// Default to thermal for backward compatibility
 		log.Printf("[%s] Warning: No printer type specified, defaulting to thermal", p.Name)
-		return sendToThermalPrinter(p, filePath)
+		return sendToThermalPrinter(ctx, p, filePath)
 	
 	default:
-		return fmt.Errorf("unsupported printer type: %s (must be thermal, inkjet, or laser)", p.Type)
+		return 0, permanent(fmt.Errorf("unsupported printer type: %s (must be thermal, inkjet, or laser)", p.Type))
 	}
 }
 
 // --- THERMAL PRINTER (ESC/POS) ---
-func sendToThermalPrinter(p model.Printer, filePath string) error {
+func sendToThermalPrinter(ctx context.Context, p model.Printer, filePath string) (int, error) {
 	log.Printf("[%s] Using thermal printer mode (ESC/POS)", p.Name)
 	
 	// Load PNG
 	imgFile, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open image: %w", err)
+		return 0, fmt.Errorf("failed to open image: %w", err)
 	}
 	defer imgFile.Close()
 
 	img, err := png.Decode(imgFile)
 	if err != nil {
-		return fmt.Errorf("failed to decode PNG: %w", err)
+		return 0, fmt.Errorf("failed to decode PNG: %w", err)
 	}
 
 	// Resize to thermal printer width (384px standard)
 	img = resizeToWidth(img, p.Size)
 
+	// Drop the page padding captured by Chrome
+	img = trimImage(img, p.MarginTopMM, p.MarginBottomMM)
+
 	// Convert to ESC/POS raster
-	escposData, err := convertImageToESCPOS(img)
+	escposData, err := convertImageToESCPOS(img, p.Dithering, p.BandHeight)
 	if err != nil {
-		return fmt.Errorf("ESC/POS conversion failed: %w", err)
+		return 0, fmt.Errorf("ESC/POS conversion failed: %w", err)
 	}
 
 	// Build complete print job
@@ -292,28 +459,11 @@ func sendToThermalPrinter(p model.Printer, filePath string) error {
 	printJob = append(printJob, 0x1B, 0x64, 0x03) // ESC d 3 - feed 3 lines
 	printJob = append(printJob, 0x1D, 0x56, 0x41, 0x00) // GS V A 0 - partial cut
 
-	log.Printf("[%s] Sending %d bytes to %s:%d", p.Name, len(printJob), p.IP, p.Port)
-
-	// Send to printer via raw TCP
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", p.IP, p.Port), 5*time.Second)
-	if err != nil {
-		return fmt.Errorf("connection failed: %w", err)
-	}
-	defer conn.Close()
-
-	_, err = conn.Write(printJob)
-	if err != nil {
-		return fmt.Errorf("write failed: %w", err)
-	}
-
-	// Give printer time to process
-	time.Sleep(500 * time.Millisecond)
-
-	return nil
+	return writeToPrinter(ctx, p, printJob)
 }
 
 // --- INKJET/LASER PRINTER (System Print Spooler) ---
-func sendToSystemPrinter(p model.Printer, filePath string) error {
+func sendToSystemPrinter(ctx context.Context, p model.Printer, filePath string) (int, error) {
 	log.Printf("[%s] Using system printer mode (%s)", p.Name, p.Type)
 	
 	var cmd *exec.Cmd
@@ -322,22 +472,22 @@ func sendToSystemPrinter(p model.Printer, filePath string) error {
 	case "darwin": // macOS
 		// Try using the printer name if configured in system
 		if p.Name != "" {
-			cmd = exec.Command("lpr", "-P", p.Name, filePath)
+			cmd = exec.CommandContext(ctx, "lpr", "-P", p.Name, filePath)
 		} else {
 			// Fallback to IPP
 			ippURI := fmt.Sprintf("ipp://%s/ipp/print", p.IP)
-			cmd = exec.Command("lpr", "-H", p.IP, filePath)
+			cmd = exec.CommandContext(ctx, "lpr", "-H", p.IP, filePath)
 			log.Printf("[%s] Using IPP URI: %s", p.Name, ippURI)
 		}
 		
 	case "linux":
 		// Try using the printer name if configured in system
 		if p.Name != "" {
-			cmd = exec.Command("lp", "-d", p.Name, filePath)
+			cmd = exec.CommandContext(ctx, "lp", "-d", p.Name, filePath)
 		} else {
 			// Fallback to IPP
 			ippURI := fmt.Sprintf("ipp://%s/ipp/print", p.IP)
-			cmd = exec.Command("lp", "-d", ippURI, filePath)
+			cmd = exec.CommandContext(ctx, "lp", "-d", ippURI, filePath)
 			log.Printf("[%s] Using IPP URI: %s", p.Name, ippURI)
 		}
 		
@@ -345,27 +495,37 @@ func sendToSystemPrinter(p model.Printer, filePath string) error {
 		// Windows printing
 		if p.Name != "" {
 			// Use mspaint for simple printing (or use a better method)
-			cmd = exec.Command("mspaint.exe", "/pt", filePath, p.Name)
+			cmd = exec.CommandContext(ctx, "mspaint.exe", "/pt", filePath, p.Name)
 		} else {
-			return fmt.Errorf("Windows printer requires printer name to be configured in system")
+			return 0, fmt.Errorf("Windows printer requires printer name to be configured in system")
 		}
 		
 	default:
-		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
+		return 0, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
 	}
 	
 	// Execute print command
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("print command failed: %w, output: %s", err, string(output))
+		return 0, fmt.Errorf("print command failed: %w, output: %s", err, string(output))
 	}
 	
 	log.Printf("[%s] Sent to system print spooler", p.Name)
-	return nil
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return 0, nil
+	}
+	return int(info.Size()), nil
 }
 
 // --- ESC/POS CONVERSION ---
-func convertImageToESCPOS(img image.Image) ([]byte, error) {
+
+const (
+	defaultBandHeight = 256  // rows per GS v 0 band, ~18KB on 80mm printers
+	maxBandHeight     = 1024 // taller bands overrun the buffer of common printers
+)
+
+func convertImageToESCPOS(img image.Image, dithering string, bandHeight int) ([]byte, error) {
 	bounds := img.Bounds()
 	width := bounds.Dx()
 	height := bounds.Dy()
@@ -378,34 +538,48 @@ func convertImageToESCPOS(img image.Image) ([]byte, error) {
 	rowBytes := width / 8
 	raster := make([]byte, rowBytes*height)
 
-	// Convert to 1-bit
+	// Convert to 1-bit (dithered as a whole so bands join seamlessly)
+	gray := toGrayscale(img, width, height)
+	dots := ditherImage(gray, width, height, dithering)
+
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			r, g, b, _ := img.At(x, y).RGBA()
-			gray := (r + g + b) / 3
-
-			bit := uint8(0)
-			if gray < 0x8000 { // threshold
-				bit = 1
+			if !dots[y*width+x] {
+				continue
 			}
 
 			byteIndex := y*rowBytes + x/8
 			bitPos := 7 - (x % 8)
-
-			if bit == 1 {
-				raster[byteIndex] |= (1 << bitPos)
-			}
+			raster[byteIndex] |= (1 << bitPos)
 		}
 	}
 
-	// ESC/POS header: GS v 0
-	header := []byte{
-		0x1D, 0x76, 0x30, 0x00,
-		byte(rowBytes), byte(rowBytes >> 8),
-		byte(height), byte(height >> 8),
+	// Printers buffer a limited amount of raster data per command, so long
+	// tickets are sent as a sequence of GS v 0 bands
+	if bandHeight <= 0 {
+		bandHeight = defaultBandHeight
+	}
+	if bandHeight > maxBandHeight {
+		bandHeight = maxBandHeight
+	}
+
+	out := make([]byte, 0, len(raster)+(height/bandHeight+1)*8)
+	for top := 0; top < height; top += bandHeight {
+		rows := bandHeight
+		if top+rows > height {
+			rows = height - top
+		}
+
+		// ESC/POS header: GS v 0
+		out = append(out,
+			0x1D, 0x76, 0x30, 0x00,
+			byte(rowBytes), byte(rowBytes>>8),
+			byte(rows), byte(rows>>8),
+		)
+		out = append(out, raster[top*rowBytes:(top+rows)*rowBytes]...)
 	}
 
-	return append(header, raster...), nil
+	return out, nil
 }
 
 // --- IMAGE RESIZING ---
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+// rasterBand is one GS v 0 command of a raster ticket.
+type rasterBand struct {
+	xL, xH byte
+	rows   int
+	data   []byte
+}
+
+// parseRasterBands splits ESC/POS raster output into its GS v 0 commands.
+func parseRasterBands(t *testing.T, out []byte) []rasterBand {
+	t.Helper()
+	var bands []rasterBand
+	for len(out) > 0 {
+		if len(out) < 8 || out[0] != 0x1D || out[1] != 0x76 || out[2] != 0x30 || out[3] != 0x00 {
+			t.Fatalf("band %d does not start with a GS v 0 header: % x", len(bands), out[:min(len(out), 8)])
+		}
+		b := rasterBand{xL: out[4], xH: out[5], rows: int(out[6]) | int(out[7])<<8}
+		size := (int(b.xL) | int(b.xH)<<8) * b.rows
+		if len(out) < 8+size {
+			t.Fatalf("band %d has %d bytes of data, want %d", len(bands), len(out)-8, size)
+		}
+		b.data = out[8 : 8+size]
+		bands = append(bands, b)
+		out = out[8+size:]
+	}
+	return bands
+}
+
+func TestConvertImageToESCPOSBands(t *testing.T) {
+	tests := []struct {
+		name       string
+		width      int
+		height     int
+		bandHeight int
+		wantXL     byte
+		wantRows   []int
+	}{
+		{"58mm default bands", 384, 600, 0, 48, []int{256, 256, 88}},
+		{"80mm default bands", 576, 600, 0, 72, []int{256, 256, 88}},
+		{"exact multiple", 576, 512, 256, 72, []int{256, 256}},
+		{"configured height", 576, 250, 100, 72, []int{100, 100, 50}},
+		{"capped height", 576, 2500, 5000, 72, []int{maxBandHeight, maxBandHeight, 2500 - 2*maxBandHeight}},
+		{"shorter than a band", 384, 10, 0, 48, []int{10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A black first and last row mark where the ticket starts and ends
+			img := ticketImage(tt.width, tt.height, 0, tt.height-1)
+			out, err := convertImageToESCPOS(img, model.DitherThreshold, tt.bandHeight)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bands := parseRasterBands(t, out)
+			if len(bands) != len(tt.wantRows) {
+				t.Fatalf("%d bands, want %d", len(bands), len(tt.wantRows))
+			}
+			for i, b := range bands {
+				if b.xL != tt.wantXL || b.xH != 0 {
+					t.Errorf("band %d: xL xH = %d %d, want %d 0", i, b.xL, b.xH, tt.wantXL)
+				}
+				if b.rows != tt.wantRows[i] {
+					t.Errorf("band %d: %d rows, want %d", i, b.rows, tt.wantRows[i])
+				}
+			}
+
+			first, last := bands[0].data, bands[len(bands)-1].data
+			if first[0] != 0xFF || first[int(tt.wantXL)] != 0x00 {
+				t.Error("first row of the ticket is not at the top of the first band")
+			}
+			if last[len(last)-1] != 0xFF {
+				t.Error("last row of the ticket is not at the bottom of the last band")
+			}
+		})
+	}
+}
+
+func TestConvertImageToESCPOSWidth(t *testing.T) {
+	// Widths are cut to whole bytes
+	img := ticketImage(389, 2)
+	img.Set(0, 1, color.Black)
+	out, err := convertImageToESCPOS(img, model.DitherThreshold, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bands := parseRasterBands(t, out)
+	if len(bands) != 1 || bands[0].xL != 48 || bands[0].rows != 2 {
+		t.Fatalf("bands = %+v, want one band of 48 bytes x 2 rows", bands)
+	}
+	if bands[0].data[48] != 0x80 {
+		t.Fatalf("second row starts with %08b, want the dot at the left edge", bands[0].data[48])
+	}
+}
+
+func TestCloseOnShutdownWaitsForWorker(t *testing.T) {
+	a := newTestAgent(t, model.Printer{Name: "Kitchen", AgentKey: "k1"})
+	received := make(chan []byte, 4)
+	conn := dialTestSocket(t, received)
+	writer := newWSWriter(conn, heartbeat{interval: time.Hour, timeout: time.Hour, writeTimeout: time.Second})
+	defer writer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	closed := make(chan struct{})
+	go func() {
+		closeOnShutdown(ctx, conn, writer, []*printAgent{a}, make(chan struct{}))
+		close(closed)
+	}()
+	cancel()
+
+	// The job in progress must still be able to send its ack
+	select {
+	case data := <-received:
+		t.Fatalf("sent %s before the worker finished", data)
+	case <-closed:
+		t.Fatal("connection closed before the worker finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(a.workerDone)
+	select {
+	case data := <-received:
+		var msg model.WSMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type != model.MessageTypeUnregister || msg.AgentKey != "k1" {
+			t.Fatalf("sent %s, want an unregister of k1", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no unregister after the worker finished")
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not closed after the unregister")
+	}
+}
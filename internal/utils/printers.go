@@ -8,6 +8,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,7 +31,7 @@ func DetectLocalIP() (string, error) {
 }
 
 func Probe(ip string, port int) bool {
-	addr := fmt.Sprintf("%s:%d", ip, port)
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
 	conn, err := net.DialTimeout("tcp", addr, 300*time.Millisecond)
 	if err != nil {
 		return false
@@ -39,62 +40,190 @@ func Probe(ip string, port int) bool {
 	return true
 }
 
-func LoadOrSetupConfig(ctx context.Context) (model.Config, error) {
-	var config model.Config
+const (
+	defaultAPIURL = "https://api.perfect-menu.it"
+	defaultWSURL  = "wss://ws.perfect-menu.it/agent"
+)
+
+// ConfigOptions are config values given on the command line or through
+// environment variables. Empty fields leave the stored value untouched.
+type ConfigOptions struct {
+	APIURL       string
+	WSURL        string
+	APIKey       string
+	TenantID     int
+	RestaurantID int
+}
+
+func (o ConfigOptions) apply(config *model.Config) {
+	if o.APIURL != "" {
+		config.ApiUrl = o.APIURL
+	}
+	if o.WSURL != "" {
+		config.WsUrl = o.WSURL
+	}
+	if o.APIKey != "" {
+		config.APIKey = o.APIKey
+	}
+	if o.TenantID != 0 {
+		config.TenantID = o.TenantID
+	}
+	if o.RestaurantID != 0 {
+		config.RestaurantID = o.RestaurantID
+	}
+}
+
+// LoadOrSetupConfig loads the config file, creating it on first run from the
+// given options. Missing values are prompted for only when a terminal is
+// attached; otherwise setup fails instead of waiting on stdin.
+func LoadOrSetupConfig(ctx context.Context, opts ConfigOptions) (model.Config, error) {
 	configFile := ctx.Value(model.ContextConfigFile).(string)
 
-	// Ensure config directory exists
-	configDir := filepath.Dir(configFile)
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return config, fmt.Errorf("failed to create config directory: %v", err)
+	config, exists, err := readConfig(configFile)
+	if err != nil {
+		return config, err
+	}
+	opts.apply(&config)
+	if exists {
+		return config, nil
 	}
 
-	if _, err := os.Stat(configFile); os.IsNotExist(err) {
-		config.AppVersion = ctx.Value(model.ContextAppVersion).(string)
-		fmt.Println("--- Initial Setup ---")
-		reader := bufio.NewReader(os.Stdin)
+	fmt.Println("--- Initial Setup ---")
+	config.AppVersion = ctx.Value(model.ContextAppVersion).(string)
+	return config, completeConfig(configFile, &config, false)
+}
 
-		apiUrl := "https://api.perfect-menu.it"
-		fmt.Printf("Enter API URL (default: %s): ", apiUrl)
-		inputApiUrl, _ := reader.ReadString('\n')
-		inputApiUrl = strings.TrimSpace(inputApiUrl)
-		if inputApiUrl != "" {
-			config.ApiUrl = inputApiUrl
-		} else {
-			config.ApiUrl = apiUrl
-		}
+// SetupConfig creates or updates the config file. With a terminal attached
+// every value is asked again, showing the current one as default.
+func SetupConfig(ctx context.Context, opts ConfigOptions) (model.Config, error) {
+	configFile := ctx.Value(model.ContextConfigFile).(string)
 
-		wsUrl := "wss://ws.perfect-menu.it/agent"
-		fmt.Printf("Enter WebSocket URL (default: %s): ", wsUrl)
-		inputWsUrl, _ := reader.ReadString('\n')
-		inputWsUrl = strings.TrimSpace(inputWsUrl)
-		if inputWsUrl != "" {
-			config.WsUrl = inputWsUrl
-		} else {
-			config.WsUrl = wsUrl
-		}
+	config, _, err := readConfig(configFile)
+	if err != nil {
+		return config, err
+	}
+	opts.apply(&config)
+	config.AppVersion = ctx.Value(model.ContextAppVersion).(string)
+	return config, completeConfig(configFile, &config, true)
+}
 
-		fmt.Print("Enter Server API Key: ")
-		config.APIKey, _ = reader.ReadString('\n')
-		config.APIKey = strings.TrimSpace(config.APIKey)
+// LoadConfig reads an existing config file without ever prompting, e.g. to
+// reload it while running.
+func LoadConfig(ctx context.Context, opts ConfigOptions) (model.Config, error) {
+	configFile := ctx.Value(model.ContextConfigFile).(string)
 
-		fmt.Print("Enter Tenant ID: ")
-		fmt.Scanln(&config.TenantID)
+	config, exists, err := readConfig(configFile)
+	if err != nil {
+		return config, err
+	}
+	if !exists {
+		return config, fmt.Errorf("%s not found", configFile)
+	}
+	opts.apply(&config)
+	return config, nil
+}
+
+func readConfig(configFile string) (model.Config, bool, error) {
+	var config model.Config
+
+	data, err := os.ReadFile(configFile)
+	if os.IsNotExist(err) {
+		return config, false, nil
+	}
+	if err != nil {
+		return config, false, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, true, fmt.Errorf("failed to parse %s: %v", configFile, err)
+	}
+	return config, true, nil
+}
+
+// completeConfig prompts for missing values (all values when askAll is set
+// and a terminal is attached), validates and saves the config.
+func completeConfig(configFile string, config *model.Config, askAll bool) error {
+	if IsInteractive() {
+		reader := bufio.NewReader(os.Stdin)
+		if askAll || config.ApiUrl == "" {
+			config.ApiUrl = prompt(reader, "Enter API URL", firstNonEmpty(config.ApiUrl, defaultAPIURL))
+		}
+		if askAll || config.WsUrl == "" {
+			config.WsUrl = prompt(reader, "Enter WebSocket URL", firstNonEmpty(config.WsUrl, defaultWSURL))
+		}
+		if askAll || config.APIKey == "" {
+			config.APIKey = prompt(reader, "Enter Server API Key", config.APIKey)
+		}
+		if askAll || config.TenantID == 0 {
+			config.TenantID = promptInt(reader, "Enter Tenant ID", config.TenantID)
+		}
+		if askAll || config.RestaurantID == 0 {
+			config.RestaurantID = promptInt(reader, "Enter Restaurant ID", config.RestaurantID)
+		}
+	}
+	config.ApiUrl = firstNonEmpty(config.ApiUrl, defaultAPIURL)
+	config.WsUrl = firstNonEmpty(config.WsUrl, defaultWSURL)
 
-		fmt.Print("Enter Restaurant ID: ")
-		fmt.Scanln(&config.RestaurantID)
+	var missing []string
+	if config.APIKey == "" {
+		missing = append(missing, "API key (--api-key / PM_API_KEY)")
+	}
+	if config.TenantID == 0 {
+		missing = append(missing, "tenant ID (--tenant / PM_TENANT_ID)")
+	}
+	if config.RestaurantID == 0 {
+		missing = append(missing, "restaurant ID (--restaurant / PM_RESTAURANT_ID)")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
 
-		data, _ := json.MarshalIndent(config, "", "  ")
-		os.WriteFile(configFile, data, 0644)
-		fmt.Println("Configuration saved.")
+	if err := os.MkdirAll(filepath.Dir(configFile), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+	data, _ := json.MarshalIndent(config, "", "  ")
+	if err := os.WriteFile(configFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to save config: %v", err)
+	}
+	fmt.Println("Configuration saved.")
+	return nil
+}
+
+// prompt reads a line from the terminal, returning def on empty input.
+func prompt(reader *bufio.Reader, label string, def string) string {
+	if def != "" {
+		fmt.Printf("%s (default: %s): ", label, def)
 	} else {
-		data, err := os.ReadFile(configFile)
-		if err != nil {
-			return config, err
+		fmt.Printf("%s: ", label)
+	}
+	input, _ := reader.ReadString('\n')
+	if input = strings.TrimSpace(input); input != "" {
+		return input
+	}
+	return def
+}
+
+func promptInt(reader *bufio.Reader, label string, def int) int {
+	defText := ""
+	if def != 0 {
+		defText = strconv.Itoa(def)
+	}
+	for i := 0; i < 3; i++ {
+		value, err := strconv.Atoi(prompt(reader, label, defText))
+		if err == nil {
+			return value
 		}
-		json.Unmarshal(data, &config)
+		fmt.Println("Please enter a number.")
 	}
-	return config, nil
+	return def
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
 
 func LoadPrinters(ctx context.Context) ([]model.Printer, error) {
@@ -111,48 +240,158 @@ func LoadPrinters(ctx context.Context) ([]model.Printer, error) {
 	return printers, err
 }
 
+// SavePrinters inserts or updates printers in the printers file. Entries are
+// matched by agent key, or by IP for printers not registered yet; printers
+// not listed are kept.
 func SavePrinters(printersFile string, printers []model.Printer) error {
+	existing, err := readPrinters(printersFile)
+	if err != nil {
+		return err
+	}
+
+	for _, printer := range printers {
+		if i := indexOfPrinter(existing, printer); i >= 0 {
+			existing[i] = printer
+		} else {
+			existing = append(existing, printer)
+		}
+	}
+	return WritePrinters(printersFile, existing)
+}
+
+// AddNewPrinters only adds printers that are not in the file yet, leaving
+// existing entries (and their local settings) untouched.
+func AddNewPrinters(printersFile string, printers []model.Printer) error {
+	existing, err := readPrinters(printersFile)
+	if err != nil {
+		return err
+	}
+
+	for _, printer := range printers {
+		if indexOfPrinter(existing, printer) < 0 {
+			existing = append(existing, printer)
+		}
+	}
+	return WritePrinters(printersFile, existing)
+}
+
+// DefaultPrinterSize is the dots per line of an 80mm thermal printer.
+const DefaultPrinterSize = 576
+
+// WritePrinters replaces the printers file with exactly the given printers.
+func WritePrinters(printersFile string, printers []model.Printer) error {
 	// Ensure config directory exists
 	configDir := filepath.Dir(printersFile)
 	if err := os.MkdirAll(configDir, 0755); err != nil {
 		return fmt.Errorf("failed to create config directory: %v", err)
 	}
 
-	// Load existing printers if file exists
-	var existingPrinters []model.Printer
-	if _, err := os.Stat(printersFile); err == nil {
-		data, err := os.ReadFile(printersFile)
-		if err != nil {
-			return fmt.Errorf("failed to read existing printers file: %v", err)
-		}
-		if err := json.Unmarshal(data, &existingPrinters); err != nil {
-			return fmt.Errorf("failed to unmarshal existing printers: %v", err)
+	// The default is applied to a copy, the caller's printers stay as they are
+	printers = append([]model.Printer(nil), printers...)
+	for i := range printers {
+		if printers[i].Size == 0 {
+			printers[i].Size = DefaultPrinterSize // Default size for backward compatibility
 		}
 	}
 
-	// Create a map of existing printers for efficient lookup
-	existingPrintersMap := make(map[string]model.Printer)
-	for _, printer := range existingPrinters {
-		if printer.Size == 0 {
-			printer.Size = 576 // Default size for backward compatibility
+	data, err := json.MarshalIndent(printers, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := printersFile + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write printers file: %v", err)
+	}
+	return os.Rename(tmpPath, printersFile)
+}
+
+func readPrinters(printersFile string) ([]model.Printer, error) {
+	data, err := os.ReadFile(printersFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing printers file: %v", err)
+	}
+	var printers []model.Printer
+	if err := json.Unmarshal(data, &printers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal existing printers: %v", err)
+	}
+	return printers, nil
+}
+
+// SamePrinter reports whether two entries describe the same printer: by
+// agent key when both have one, by IP otherwise.
+func SamePrinter(a, b model.Printer) bool {
+	if a.AgentKey != "" && b.AgentKey != "" {
+		return a.AgentKey == b.AgentKey
+	}
+	return a.IP == b.IP
+}
+
+func indexOfPrinter(printers []model.Printer, p model.Printer) int {
+	for i := range printers {
+		if SamePrinter(printers[i], p) {
+			return i
 		}
-		// Use IP as the unique identifier for printers
-		existingPrintersMap[printer.IP] = printer
 	}
+	return -1
+}
 
-	// Add new printers that don't exist
-	for _, printer := range printers {
-		if _, exists := existingPrintersMap[printer.IP]; !exists {
-			if printer.Size == 0 {
-				printer.Size = 576 // Default size for backward compatibility
+// FindPrinter looks a printer up by agent key, name (case-insensitive) or IP.
+func FindPrinter(printers []model.Printer, ref string) (int, error) {
+	ref = strings.TrimSpace(ref)
+	match := -1
+	for i, p := range printers {
+		if p.AgentKey != "" && p.AgentKey == ref {
+			return i, nil
+		}
+		if strings.EqualFold(p.Name, ref) || p.IP == ref {
+			if match >= 0 {
+				return -1, fmt.Errorf("%q matches more than one printer, use the agent key", ref)
 			}
-			existingPrinters = append(existingPrinters, printer)
+			match = i
 		}
 	}
+	if match < 0 {
+		return -1, fmt.Errorf("printer %q not found", ref)
+	}
+	return match, nil
+}
 
-	data, err := json.MarshalIndent(existingPrinters, "", "  ")
-	if err != nil {
-		return err
+// ValidatePrinter checks the settings of a printer before it is saved.
+func ValidatePrinter(p model.Printer) error {
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if net.ParseIP(p.IP) == nil {
+		return fmt.Errorf("invalid IP address %q", p.IP)
+	}
+	if p.Port < 1 || p.Port > 65535 {
+		return fmt.Errorf("invalid port %d (1-65535)", p.Port)
+	}
+
+	printerType := strings.ToLower(strings.TrimSpace(p.Type))
+	switch printerType {
+	case "", model.PrinterTypeThermal, model.PrinterTypeInkjet, model.PrinterTypeLaser:
+	default:
+		return fmt.Errorf("invalid type %q (thermal, inkjet or laser)", p.Type)
+	}
+	if printerType == "" || printerType == model.PrinterTypeThermal {
+		// Raster rows are sent in whole bytes; 384 = 58mm, 576 = 80mm paper
+		if p.Size < 8 || p.Size > 2048 || p.Size%8 != 0 {
+			return fmt.Errorf("invalid size %d (dots per line, a multiple of 8, e.g. 384 or 576)", p.Size)
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(p.Renderer)) {
+	case "", model.RendererImage:
+	case model.RendererText:
+		if printerType != "" && printerType != model.PrinterTypeThermal {
+			return fmt.Errorf("the text renderer is only supported by thermal printers")
+		}
+	default:
+		return fmt.Errorf("invalid renderer %q (image or text)", p.Renderer)
 	}
-	return os.WriteFile(printersFile, data, 0644)
+	return nil
 }
@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Riboost-Studio/perfect-menu-print-orders/internal/model"
+)
+
+func configContext(t *testing.T) (context.Context, string) {
+	t.Helper()
+	if IsInteractive() {
+		t.Skip("stdin is a terminal: setup would prompt")
+	}
+	configFile := filepath.Join(t.TempDir(), "config", "config.json")
+	ctx := context.WithValue(context.Background(), model.ContextConfigFile, configFile)
+	ctx = context.WithValue(ctx, model.ContextAppVersion, "test")
+	return ctx, configFile
+}
+
+func readTestConfig(t *testing.T, configFile string) model.Config {
+	t.Helper()
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config model.Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestLoadOrSetupConfigFirstRun(t *testing.T) {
+	ctx, configFile := configContext(t)
+	opts := ConfigOptions{APIKey: "secret", TenantID: 3, RestaurantID: 7}
+
+	config, err := LoadOrSetupConfig(ctx, opts)
+	if err != nil {
+		t.Fatalf("LoadOrSetupConfig = %v", err)
+	}
+	want := model.Config{ApiUrl: defaultAPIURL, WsUrl: defaultWSURL, APIKey: "secret", TenantID: 3, RestaurantID: 7, AppVersion: "test"}
+	if !reflect.DeepEqual(config, want) {
+		t.Fatalf("config = %+v, want %+v", config, want)
+	}
+	if saved := readTestConfig(t, configFile); !reflect.DeepEqual(saved, want) {
+		t.Fatalf("saved config = %+v, want %+v", saved, want)
+	}
+}
+
+func TestLoadOrSetupConfigMissingValues(t *testing.T) {
+	ctx, configFile := configContext(t)
+
+	_, err := LoadOrSetupConfig(ctx, ConfigOptions{TenantID: 3})
+	if err == nil {
+		t.Fatal("setup without API key and restaurant succeeded")
+	}
+	for _, hint := range []string{"PM_API_KEY", "PM_RESTAURANT_ID"} {
+		if !strings.Contains(err.Error(), hint) {
+			t.Errorf("error %q does not mention %s", err, hint)
+		}
+	}
+	if strings.Contains(err.Error(), "PM_TENANT_ID") {
+		t.Errorf("error %q asks for the tenant that was given", err)
+	}
+	if _, err := os.Stat(configFile); !os.IsNotExist(err) {
+		t.Fatal("incomplete config was saved")
+	}
+}
+
+func TestLoadOrSetupConfigOptionsOverride(t *testing.T) {
+	ctx, configFile := configContext(t)
+	stored := model.Config{ApiUrl: "https://api.example", WsUrl: "wss://ws.example", APIKey: "old", TenantID: 3, RestaurantID: 7}
+	if err := os.MkdirAll(filepath.Dir(configFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(stored)
+	if err := os.WriteFile(configFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts ConfigOptions
+		want func(c *model.Config)
+	}{
+		{"no options", ConfigOptions{}, func(c *model.Config) {}},
+		{"api key", ConfigOptions{APIKey: "new"}, func(c *model.Config) { c.APIKey = "new" }},
+		{"urls and ids", ConfigOptions{APIURL: "http://localhost", WSURL: "ws://localhost", TenantID: 4, RestaurantID: 8}, func(c *model.Config) {
+			c.ApiUrl, c.WsUrl, c.TenantID, c.RestaurantID = "http://localhost", "ws://localhost", 4, 8
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := stored
+			tt.want(&want)
+			for _, load := range []func(context.Context, ConfigOptions) (model.Config, error){LoadOrSetupConfig, LoadConfig} {
+				config, err := load(ctx, tt.opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(config, want) {
+					t.Fatalf("config = %+v, want %+v", config, want)
+				}
+			}
+			// Options apply to this run only
+			if saved := readTestConfig(t, configFile); !reflect.DeepEqual(saved, stored) {
+				t.Fatalf("saved config = %+v, want it unchanged", saved)
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	ctx, configFile := configContext(t)
+	if _, err := LoadConfig(ctx, ConfigOptions{}); err == nil {
+		t.Fatal("LoadConfig without a config file succeeded")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOrSetupConfig(ctx, ConfigOptions{}); err == nil {
+		t.Fatal("LoadOrSetupConfig with a broken config file succeeded")
+	}
+}
+
+func TestSavePrintersUpsert(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "printers.json")
+	kitchen := model.Printer{Name: "Kitchen", IP: "10.0.0.10", Port: 9100, AgentKey: "k1", Size: 576, Template: "kitchen"}
+	bar := model.Printer{Name: "Bar", IP: "10.0.0.11", Port: 9100, Size: 384}
+	if err := WritePrinters(file, []model.Printer{kitchen, bar}); err != nil {
+		t.Fatal(err)
+	}
+
+	renamed := kitchen
+	renamed.Name, renamed.IP = "Kitchen 2", "10.0.0.20" // same key, new IP
+	registered := bar
+	registered.AgentKey = "k2" // same IP, key obtained
+	terrace := model.Printer{Name: "Terrace", IP: "10.0.0.12", Port: 9100}
+	if err := SavePrinters(file, []model.Printer{renamed, registered, terrace}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readPrinters(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	terrace.Size = DefaultPrinterSize
+	want := []model.Printer{renamed, registered, terrace}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("printers = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestWritePrintersKeepsCallerSlice(t *testing.T) {
+	printers := []model.Printer{{Name: "Kitchen", IP: "10.0.0.10"}}
+	if err := WritePrinters(filepath.Join(t.TempDir(), "printers.json"), printers); err != nil {
+		t.Fatal(err)
+	}
+	if printers[0].Size != 0 {
+		t.Fatalf("caller's size = %d, want it untouched", printers[0].Size)
+	}
+}
+
+func TestFindPrinter(t *testing.T) {
+	printers := []model.Printer{
+		{Name: "Kitchen", IP: "10.0.0.10", AgentKey: "k1"},
+		{Name: "Bar", IP: "10.0.0.11", AgentKey: "k2"},
+		{Name: "10.0.0.10", IP: "10.0.0.12"}, // named like another printer's IP
+	}
+	tests := []struct {
+		ref     string
+		want    int
+		wantErr bool
+	}{
+		{"k2", 1, false},
+		{"kitchen", 0, false},
+		{" Bar ", 1, false},
+		{"10.0.0.11", 1, false},
+		{"10.0.0.12", 2, false},
+		{"10.0.0.10", -1, true},
+		{"Terrace", -1, true},
+	}
+	for _, tt := range tests {
+		got, err := FindPrinter(printers, tt.ref)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("FindPrinter(%q) = %d, %v; want %d, error %v", tt.ref, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestValidatePrinter(t *testing.T) {
+	valid := model.Printer{Name: "Kitchen", IP: "10.0.0.10", Port: 9100, Type: model.PrinterTypeThermal, Size: 576}
+	tests := []struct {
+		name    string
+		edit    func(p *model.Printer)
+		wantErr bool
+	}{
+		{"valid", func(p *model.Printer) {}, false},
+		{"no type is thermal", func(p *model.Printer) { p.Type = "" }, false},
+		{"58mm", func(p *model.Printer) { p.Size = 384 }, false},
+		{"text renderer", func(p *model.Printer) { p.Renderer = model.RendererText }, false},
+		{"laser ignores size", func(p *model.Printer) { p.Type, p.Size = model.PrinterTypeLaser, 0 }, false},
+		{"blank name", func(p *model.Printer) { p.Name = " " }, true},
+		{"bad IP", func(p *model.Printer) { p.IP = "10.0.0" }, true},
+		{"port 0", func(p *model.Printer) { p.Port = 0 }, true},
+		{"port too high", func(p *model.Printer) { p.Port = 70000 }, true},
+		{"unknown type", func(p *model.Printer) { p.Type = "dot-matrix" }, true},
+		{"size not whole bytes", func(p *model.Printer) { p.Size = 580 }, true},
+		{"no size", func(p *model.Printer) { p.Size = 0 }, true},
+		{"unknown renderer", func(p *model.Printer) { p.Renderer = "pdf" }, true},
+		{"text on laser", func(p *model.Printer) { p.Type, p.Renderer = model.PrinterTypeLaser, model.RendererText }, true},
+	}
+	for _, tt := range tests {
+		p := valid
+		tt.edit(&p)
+		if err := ValidatePrinter(p); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidatePrinter = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestReadPrintersDefaultsToEnabled(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "printers.json")
+	// Kitchen was saved before isEnabled was honored
+	data := `[{"name":"Kitchen","ip":"10.0.0.10","port":9100},{"name":"Bar","ip":"10.0.0.11","port":9100,"isEnabled":false}]`
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	printers, err := readPrinters(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(printers) != 2 || !printers[0].IsEnabled || printers[1].IsEnabled {
+		t.Fatalf("printers = %+v, want Kitchen enabled and Bar disabled", printers)
+	}
+}
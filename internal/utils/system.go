@@ -16,6 +16,20 @@ type SystemInfo struct {
 	ChromePath      string
 }
 
+// IsInteractive reports whether stdin is a terminal, i.e. someone can answer
+// prompts. Under cron, systemd or provisioning tools it is false.
+func IsInteractive() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	// /dev/null is a character device too, and what cron gives us
+	if null, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, null) {
+		return false
+	}
+	return true
+}
+
 // DetectSystem returns information about the current operating system and architecture
 func DetectSystem() SystemInfo {
 	return SystemInfo{
@@ -90,7 +104,9 @@ func getCommonChromePaths() []string {
 // VALIDATION
 // --------------------------------------
 
-func ValidateSystemRequirements() error {
+// ValidateSystemRequirements prints system information and checks for Chrome.
+// A missing Chrome is only fatal when requireChrome is set (image rendering).
+func ValidateSystemRequirements(requireChrome bool) error {
 	sysInfo := DetectSystem()
 
 	fmt.Printf("System Information:\n")
@@ -110,6 +126,12 @@ func ValidateSystemRequirements() error {
 	}
 
 	// Chrome not found
+	if !requireChrome {
+		fmt.Println("- Chrome / Chromium not found (not needed: all printers use text mode)")
+		fmt.Println()
+		return nil
+	}
+
 	fmt.Println("✗ Chrome / Chromium not found!")
 	fmt.Println("  It is required for PDF generation using headless Chrome.")
 	fmt.Println()
@@ -135,7 +157,8 @@ func getChromeVersion(path string) string {
 // --------------------------------------
 
 func showChromeInstallationInstructions(osType string) {
-	fmt.Println("Installation Instructions:\n")
+	fmt.Println("Installation Instructions:")
+	fmt.Println()
 
 	switch osType {
 
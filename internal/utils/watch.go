@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// --- File Watching ---
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size(), exists: true}
+}
+
+// WatchFiles polls the given files and signals on the returned channel when
+// any of them is created, modified or removed. Changes seen while the
+// previous signal is still pending are merged into it.
+func WatchFiles(ctx context.Context, interval time.Duration, paths ...string) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	stamps := make([]fileStamp, len(paths))
+	for i, path := range paths {
+		stamps[i] = statFile(path)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			dirty := false
+			for i, path := range paths {
+				if stamp := statFile(path); stamp != stamps[i] {
+					stamps[i] = stamp
+					dirty = true
+				}
+			}
+			if dirty {
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changed
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testPollInterval = 10 * time.Millisecond
+
+// writeStamped writes content to path with a fixed modification time.
+func writeStamped(t *testing.T, path string, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// changed reports whether the watcher signalled within a few poll intervals.
+func changed(changes <-chan struct{}) bool {
+	select {
+	case <-changes:
+		return true
+	case <-time.After(20 * testPollInterval):
+		return false
+	}
+}
+
+func startWatch(t *testing.T, paths ...string) <-chan struct{} {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return WatchFiles(ctx, testPollInterval, paths...)
+}
+
+func TestWatchFilesChange(t *testing.T) {
+	dir := t.TempDir()
+	config, printers := filepath.Join(dir, "config.json"), filepath.Join(dir, "printers.json")
+	stamp := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeStamped(t, config, "{}", stamp)
+	writeStamped(t, printers, "[]", stamp)
+	changes := startWatch(t, config, printers)
+
+	writeStamped(t, printers, `[{"name":"Kitchen"}]`, stamp.Add(time.Second))
+	if !changed(changes) {
+		t.Fatal("no signal after the printers file changed")
+	}
+
+	// Same size, newer modification time
+	writeStamped(t, config, "{ }", stamp.Add(time.Second))
+	writeStamped(t, config, "{ }", stamp.Add(2*time.Second))
+	if !changed(changes) {
+		t.Fatal("no signal after the config file was touched")
+	}
+}
+
+func TestWatchFilesDeleteAndRecreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "printers.json")
+	stamp := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeStamped(t, path, "[]", stamp)
+	changes := startWatch(t, path)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if !changed(changes) {
+		t.Fatal("no signal after the file was removed")
+	}
+	writeStamped(t, path, "[]", stamp)
+	if !changed(changes) {
+		t.Fatal("no signal after the file was created again")
+	}
+}
+
+func TestWatchFilesIgnoresUnchangedStamp(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "printers.json")
+	stamp := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeStamped(t, path, "[1]", stamp)
+	changes := startWatch(t, path)
+
+	// Rewritten with the same size and modification time
+	writeStamped(t, path, "[2]", stamp)
+	if changed(changes) {
+		t.Fatal("signal although the modification time and size did not change")
+	}
+}